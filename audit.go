@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stages of an audited RPC, every call writing an attempt event before running and a result event after.
+const (
+	// AuditStageAttempt is the event written before the handler runs, a call whose attempt can't be written is
+	// rejected
+	AuditStageAttempt = "attempt"
+	// AuditStageResult is the event written once the handler returned, failed or panicked
+	AuditStageResult = "result"
+)
+
+// auditedMethods are the full method names of the mutating RPCs written to the audit log.
+var auditedMethods = map[string]bool{
+	myservice.MyService_MyMethod_FullMethodName:      true,
+	myservice.MyService_CreateRecords_FullMethodName: true,
+	myservice.MyService_DeleteRecord_FullMethodName:  true,
+}
+
+// AuditEvent is an entry of the audit log of the mutating RPCs.
+type AuditEvent struct {
+	// Time is when the event occurred
+	Time time.Time `json:"time"`
+	// Stage is AuditStageAttempt or AuditStageResult
+	Stage string `json:"stage"`
+	// RequestID is the request ID, pairing the attempt and the result of a call
+	RequestID string `json:"request_id"`
+	// Method is the full method name
+	Method string `json:"method"`
+	// Subject is the subject of the authenticated principal, empty without authentication
+	Subject string `json:"subject"`
+	// Tenant is the tenant ID with MULTITENANT
+	Tenant string `json:"tenant,omitempty"`
+	// ClientIP is the IP address of the client, the HTTP client for the REST calls
+	ClientIP string `json:"client_ip,omitempty"`
+	// Keys are the record keys of the request
+	Keys []string `json:"keys"`
+	// Code is the gRPC status code of the result
+	Code string `json:"code,omitempty"`
+	// Error is the error message of a failed result
+	Error string `json:"error,omitempty"`
+	// Duration is how long the handler took, for the result
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// AuditSink stores the audit events, append-only. The file of AUDIT_LOG_PATH and the audit_records table of
+// AUDIT_DATABASE are built in, replace them with WithAuditSink, e.g. to ship the events to a dedicated service.
+type AuditSink interface {
+	// Write stores an event, returning once it is durable
+	Write(ctx context.Context, event AuditEvent) error
+}
+
+// auditUnaryInterceptor builds an interceptor writing the audit events of the auditedMethods: an attempt before the
+// handler runs, rejecting the call with codes.Unavailable if it can't be written so no mutation goes unaudited, then
+// the result once the handler returned, including its failure or panic. Chain it after auth and tenant so the
+// events carry the principal and the tenant.
+//
+// Parameters:
+//   - sink: The audit sink
+//
+// Returns:
+//   - The audit interceptor
+func auditUnaryInterceptor(sink AuditSink) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		if !auditedMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		event := newAuditEvent(ctx, info.FullMethod, req)
+		if err := sink.Write(ctx, event); err != nil {
+			loggerFromContext(ctx).Error("failed to write the audit event, rejecting the request", "method", info.FullMethod, "error", err)
+			return nil, errorWithInfo(codes.Unavailable, reasonAuditUnavailable, "audit log unavailable", nil)
+		}
+
+		start := time.Now()
+		defer func() {
+			event.Time, event.Stage, event.Duration = time.Now(), AuditStageResult, time.Since(start)
+			r := recover()
+			switch {
+			case r != nil:
+				event.Code, event.Error = codes.Internal.String(), fmt.Sprintf("panic: %v", r)
+			case err != nil:
+				event.Code, event.Error = status.Code(err).String(), status.Convert(err).Message()
+			default:
+				event.Code = codes.OK.String()
+			}
+			// The operation already ran, record it even when the client went away
+			if writeErr := sink.Write(context.WithoutCancel(ctx), event); writeErr != nil {
+				loggerFromContext(ctx).Error("failed to write the audit result", "method", info.FullMethod, "error", writeErr)
+			}
+			// Let the recovery interceptor handle the panic
+			if r != nil {
+				panic(r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// newAuditEvent builds the attempt event of a call.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - method: The full method name
+//   - req: The request message
+//
+// Returns:
+//   - The attempt event
+func newAuditEvent(ctx context.Context, method string, req any) AuditEvent {
+	event := AuditEvent{
+		Time:      time.Now(),
+		Stage:     AuditStageAttempt,
+		RequestID: requestIDFromContext(ctx),
+		Method:    method,
+		ClientIP:  peerIP(ctx),
+		Keys:      auditKeys(req),
+	}
+	if principal, ok := principalFromContext(ctx); ok {
+		event.Subject = principal.Subject
+	}
+	if t, ok := tenantFromContext(ctx); ok {
+		event.Tenant = t.id
+	}
+	return event
+}
+
+// auditKeys returns the record keys of an audited request.
+//
+// Parameters:
+//   - req: The request message
+//
+// Returns:
+//   - The record keys, nil for an unknown request type
+func auditKeys(req any) []string {
+	switch r := req.(type) {
+	case *myservice.MyRequest:
+		return []string{r.GetA()}
+	case *myservice.CreateRecordsRequest:
+		keys := make([]string, 0, len(r.GetRecords()))
+		for _, record := range r.GetRecords() {
+			keys = append(keys, record.GetA())
+		}
+		return keys
+	case *myservice.DeleteRecordRequest:
+		return []string{r.GetA()}
+	default:
+		return nil
+	}
+}
+
+// fileAuditSink appends the audit events to a file as JSON lines, synced after every event.
+type fileAuditSink struct {
+	// mu serializes the writes
+	mu sync.Mutex
+	// file is the audit log file, opened in append mode
+	file *os.File
+}
+
+// openFileAuditSink opens the audit log file, creating it readable by the owner only.
+//
+// Parameters:
+//   - path: The path of the audit log file (AUDIT_LOG_PATH)
+//
+// Returns:
+//   - The file sink, to close on shutdown
+//   - An error if the file can't be opened
+func openFileAuditSink(path string) (*fileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &fileAuditSink{file: file}, nil
+}
+
+// Write appends an event to the file and syncs it to the disk.
+//
+// Parameters:
+//   - ctx: The context of the request, unused
+//   - event: The event
+//
+// Returns:
+//   - An error if the event can't be written or synced
+func (s *fileAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *fileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// AuditRecord is a row of the audit_records table written with AUDIT_DATABASE, in the schema of the tenant with
+// MULTITENANT.
+type AuditRecord struct {
+	ID         uint64    `gorm:"column:id;primaryKey;autoIncrement"`
+	Time       time.Time `gorm:"column:time;index"`
+	Stage      string    `gorm:"column:stage;size:16"`
+	RequestID  string    `gorm:"column:request_id;size:255;index"`
+	Method     string    `gorm:"column:method;size:255"`
+	Subject    string    `gorm:"column:subject;size:255"`
+	Tenant     string    `gorm:"column:tenant;size:255"`
+	ClientIP   string    `gorm:"column:client_ip;size:64"`
+	Keys       string    `gorm:"column:record_keys;type:text"`
+	Code       string    `gorm:"column:code;size:32"`
+	Error      string    `gorm:"column:error;type:text"`
+	DurationMS int64     `gorm:"column:duration_ms"`
+}
+
+// databaseAuditSink inserts the audit events into the audit_records table of the primary database.
+type databaseAuditSink struct {
+	// app gives access to the primary database, connected after the sink is created
+	app *Application
+}
+
+// Write inserts an event, failing while the database isn't connected.
+//
+// Parameters:
+//   - ctx: The context of the request, carrying the tenant the row is written for
+//   - event: The event
+//
+// Returns:
+//   - An error if the row can't be inserted
+func (s *databaseAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	db := s.app.primaryDB()
+	if db == nil {
+		return errDatabaseUnavailable
+	}
+	record := AuditRecord{
+		Time:       event.Time,
+		Stage:      event.Stage,
+		RequestID:  event.RequestID,
+		Method:     event.Method,
+		Subject:    event.Subject,
+		Tenant:     event.Tenant,
+		ClientIP:   event.ClientIP,
+		Keys:       strings.Join(event.Keys, ","),
+		Code:       event.Code,
+		Error:      event.Error,
+		DurationMS: event.Duration.Milliseconds(),
+	}
+	return db.WithContext(ctx).Create(&record).Error
+}
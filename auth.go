@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Principal is the authenticated caller of an RPC, stored in the context by the auth interceptors.
+type Principal struct {
+	// Subject identifies the caller (API_TOKEN_SUBJECT for the API_TOKEN bearer)
+	Subject string
+	// Scopes are the permissions granted to the caller (API_TOKEN_SCOPES for the API_TOKEN bearer)
+	Scopes []string
+}
+
+// principalKey is the context key of the authenticated principal.
+type principalKey struct{}
+
+// authUnaryInterceptor builds an interceptor rejecting the RPCs that don't carry the expected bearer token
+// in the authorization metadata header with codes.Unauthenticated, and storing the principal of the token in the
+// context of the others for principalFromContext.
+//
+// Parameters:
+//   - token: The expected bearer token
+//   - principal: The principal authenticated by the token
+//   - skipMethods: The full method names (e.g. /grpc.health.v1.Health/Check) that bypass authentication
+//
+// Returns:
+//   - The authentication interceptor
+func authUnaryInterceptor(token string, principal Principal, skipMethods []string) grpc.UnaryServerInterceptor {
+	skip := methodSet(skipMethods)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !skip[info.FullMethod] {
+			if err := checkBearerToken(ctx, token); err != nil {
+				return nil, err
+			}
+			ctx = context.WithValue(ctx, principalKey{}, principal)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authStreamInterceptor is the streaming counterpart of authUnaryInterceptor, rejecting the stream before the
+// handler runs.
+//
+// Parameters:
+//   - token: The expected bearer token
+//   - principal: The principal authenticated by the token
+//   - skipMethods: The full method names that bypass authentication
+//
+// Returns:
+//   - The authentication interceptor
+func authStreamInterceptor(token string, principal Principal, skipMethods []string) grpc.StreamServerInterceptor {
+	skip := methodSet(skipMethods)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !skip[info.FullMethod] {
+			if err := checkBearerToken(ss.Context(), token); err != nil {
+				return err
+			}
+			ss = &contextServerStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), principalKey{}, principal)}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// methodSet builds a set of full method names for fast lookups.
+//
+// Parameters:
+//   - methods: The full method names
+//
+// Returns:
+//   - The set of methods
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		set[method] = true
+	}
+	return set
+}
+
+// checkBearerToken verifies the bearer token of the authorization metadata header.
+// The comparison runs in constant time so response timings don't leak the expected token.
+//
+// Parameters:
+//   - ctx: The context of the request carrying the incoming metadata
+//   - token: The expected bearer token
+//
+// Returns:
+//   - A codes.Unauthenticated status error if the token is missing or wrong, nil otherwise
+func checkBearerToken(ctx context.Context, token string) error {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		return status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+	provided, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return nil
+}
+
+// authzUnaryInterceptor builds an interceptor rejecting the RPCs whose caller lacks a scope required by the method
+// with codes.PermissionDenied, see requireScopes. Chain it after the auth interceptor storing the principal.
+//
+// Parameters:
+//   - methodScopes: The scopes required by every method, keyed by full method name, the other methods needing none
+//
+// Returns:
+//   - The authorization interceptor
+func authzUnaryInterceptor(methodScopes map[string][]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := requireScopes(ctx, methodScopes[info.FullMethod]...); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authzStreamInterceptor is the streaming counterpart of authzUnaryInterceptor, rejecting the stream before the
+// handler runs.
+//
+// Parameters:
+//   - methodScopes: The scopes required by every method, keyed by full method name
+//
+// Returns:
+//   - The authorization interceptor
+func authzStreamInterceptor(methodScopes map[string][]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := requireScopes(ss.Context(), methodScopes[info.FullMethod]...); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// principalFromContext returns the authenticated caller of the RPC being served.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The principal
+//   - false without API_TOKEN, for an AUTH_SKIP_METHODS method or outside of an RPC
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// requireScopes checks that the caller was granted every given scope, for the handlers restricting a method to
+// some callers. A call without principal has no scope.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - scopes: The required scopes
+//
+// Returns:
+//   - A codes.PermissionDenied error listing the missing scopes in the "scopes" metadata, nil if none is missing
+func requireScopes(ctx context.Context, scopes ...string) error {
+	principal, _ := principalFromContext(ctx)
+	var missing []string
+	for _, scope := range scopes {
+		if !slices.Contains(principal.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return errorWithInfo(codes.PermissionDenied, reasonMissingScope, "missing scope "+strings.Join(missing, ", "),
+		map[string]string{"scopes": strings.Join(missing, ",")})
+}
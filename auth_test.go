@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestAuthzInterceptor checks that the authorization interceptor lets through the callers holding every scope of
+// the method, and rejects with PermissionDenied the callers missing one and the calls without principal.
+func TestAuthzInterceptor(t *testing.T) {
+	interceptor := authzUnaryInterceptor(map[string][]string{
+		"/myservice.MyService/DeleteRecord":  {"records:delete"},
+		"/myservice.MyService/CreateRecords": {"records:write", "records:bulk"},
+	})
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	principal := func(scopes ...string) context.Context {
+		return context.WithValue(context.Background(), principalKey{}, Principal{Subject: "client", Scopes: scopes})
+	}
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+		// missing are the scopes listed by the PermissionDenied error
+		missing string
+	}{
+		{"scope match", principal("records:delete"), "/myservice.MyService/DeleteRecord", codes.OK, ""},
+		{"every scope", principal("records:bulk", "records:write"), "/myservice.MyService/CreateRecords", codes.OK, ""},
+		{"missing scope", principal("records:write"), "/myservice.MyService/DeleteRecord", codes.PermissionDenied, "records:delete"},
+		{"one scope missing", principal("records:write"), "/myservice.MyService/CreateRecords", codes.PermissionDenied, "records:bulk"},
+		{"unauthenticated", context.Background(), "/myservice.MyService/DeleteRecord", codes.PermissionDenied, "records:delete"},
+		{"unlisted method", context.Background(), "/myservice.MyService/GetRecord", codes.OK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("the interceptor returned %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				return
+			}
+			info := errorInfo(t, err)
+			if info.GetReason() != reasonMissingScope || info.GetMetadata()["scopes"] != tt.missing {
+				t.Fatalf("reason %q with scopes %q, want %q with %q",
+					info.GetReason(), info.GetMetadata()["scopes"], reasonMissingScope, tt.missing)
+			}
+		})
+	}
+}
+
+// TestMethodScopes checks METHOD_SCOPES over the wire: a call without the token is Unauthenticated before any scope
+// check, and the callers with the token get the scopes of API_TOKEN_SCOPES.
+func TestMethodScopes(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, map[string]string{
+		"API_TOKEN":        "secret",
+		"API_TOKEN_SCOPES": "records:read",
+		"METHOD_SCOPES":    "/myservice.MyService/GetVersion=records:read,/myservice.MyService/DeleteRecord=records:delete",
+	}))
+	client := myservice.NewMyServiceClient(conn)
+	authenticated := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{
+			name: "scope match",
+			call: func() error {
+				_, err := client.GetVersion(authenticated, &myservice.GetVersionRequest{})
+				return err
+			},
+			want: codes.OK,
+		},
+		{
+			name: "missing scope",
+			call: func() error {
+				_, err := client.DeleteRecord(authenticated, &myservice.DeleteRecordRequest{A: "key"})
+				return err
+			},
+			want: codes.PermissionDenied,
+		},
+		{
+			name: "unauthenticated",
+			call: func() error {
+				_, err := client.GetVersion(context.Background(), &myservice.GetVersionRequest{})
+				return err
+			},
+			want: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := status.Code(tt.call()); code != tt.want {
+				t.Fatalf("the call returned %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
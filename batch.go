@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// createRecordRows inserts the given requests as TableRecord rows with their attributes, batchSize rows per INSERT,
+// replacing the soft deleted records of the same keys.
+//
+// Parameters:
+//   - tx: The transaction to write in
+//   - reqs: The requested records, in request order
+//   - indexes: The indexes of the records of reqs to insert
+//   - createdBy: The subject of the principal creating the records, empty without authentication
+//   - batchSize: The number of rows of every INSERT
+//
+// Returns:
+//   - An error if an INSERT failed, the transaction should be rolled back then
+func createRecordRows(tx *gorm.DB, reqs []*myservice.MyRequest, indexes []int, createdBy string, batchSize int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	records := make([]TableRecord, 0, len(indexes))
+	keys := make([]string, 0, len(indexes))
+	var attributes []RecordAttribute
+	for _, i := range indexes {
+		req := reqs[i]
+		records = append(records, TableRecord{A: req.GetA(), B: req.GetB(), CreatedBy: createdBy})
+		keys = append(keys, req.GetA())
+		for name, value := range req.GetD() {
+			attributes = append(attributes, RecordAttribute{RecordA: req.GetA(), Name: name, Value: value})
+		}
+	}
+	if err := purgeDeletedRecords(tx, keys); err != nil {
+		return err
+	}
+	if err := tx.CreateInBatches(&records, batchSize).Error; err != nil {
+		return err
+	}
+	if len(attributes) > 0 {
+		return tx.CreateInBatches(&attributes, batchSize).Error
+	}
+	return nil
+}
+
+// setRecordResult records the outcome of a record creation in its result, leaving it OK when err is nil.
+//
+// Parameters:
+//   - result: The result of the record
+//   - err: The error of the record creation, mapped to a gRPC status with toGRPCError
+func setRecordResult(result *myservice.RecordResult, err error) {
+	if err == nil {
+		return
+	}
+	st := status.Convert(toGRPCError(err))
+	result.Code = int32(st.Code())
+	result.Message = st.Message()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus collectors of the record cache.
+var (
+	// recordCacheHitsTotal counts the GetRecord calls served from the cache
+	recordCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "record_cache_hits_total",
+		Help: "Total number of record lookups served from the cache.",
+	})
+	// recordCacheMissesTotal counts the GetRecord calls that queried the database
+	recordCacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "record_cache_misses_total",
+		Help: "Total number of record lookups missing from the cache or expired.",
+	})
+	// recordCacheEvictionsTotal counts the records evicted to make room for a new one
+	recordCacheEvictionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "record_cache_evictions_total",
+		Help: "Total number of records evicted from the full cache.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(recordCacheHitsTotal, recordCacheMissesTotal, recordCacheEvictionsTotal)
+}
+
+// recordCache is an in-process LRU cache of the records read by GetRecord, keyed by tenant and record key.
+// An entry expires after the TTL, and the writes of a key invalidate it, so a cached record is at most TTL old
+// when another instance or a direct database write changed it. A nil cache caches nothing.
+type recordCache struct {
+	// mu protects the fields below
+	mu sync.Mutex
+	// size is the maximum number of cached records
+	size int
+	// ttl is how long a record is served from the cache
+	ttl time.Duration
+	// entries holds the list element of every cached key
+	entries map[string]*list.Element
+	// order holds the recordCacheEntry values, the most recently used first
+	order *list.List
+	// generation counts the invalidations, so a record read before one isn't cached after it
+	generation uint64
+}
+
+// recordCacheEntry is a cached record.
+type recordCacheEntry struct {
+	// key is the cache key of the record
+	key string
+	// record is the cached record
+	record TableRecord
+	// expiresAt is the time the entry stops being served
+	expiresAt time.Time
+}
+
+// newRecordCache creates a record cache.
+//
+// Parameters:
+//   - size: The maximum number of cached records, 0 disables the cache (CACHE_SIZE)
+//   - ttl: How long a record is served from the cache (CACHE_TTL)
+//
+// Returns:
+//   - The record cache, nil when disabled
+func newRecordCache(size int, ttl time.Duration) *recordCache {
+	if size <= 0 {
+		return nil
+	}
+	return &recordCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// recordCacheKey returns the cache key of a record, scoped to the tenant of the request with MULTITENANT.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - a: The record key
+//
+// Returns:
+//   - The cache key
+func recordCacheKey(ctx context.Context, a string) string {
+	if t, ok := tenantFromContext(ctx); ok {
+		return t.id + "\x00" + a
+	}
+	return a
+}
+
+// get returns the cached record of key, counting the hit or the miss.
+//
+// Parameters:
+//   - key: The cache key
+//
+// Returns:
+//   - The cached record
+//   - true if the record was cached and not expired
+//   - The generation to pass to set when caching the record read after a miss
+func (c *recordCache) get(key string) (TableRecord, bool, uint64) {
+	if c == nil {
+		return TableRecord{}, false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*recordCacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			c.order.MoveToFront(element)
+			recordCacheHitsTotal.Inc()
+			return entry.record, true, c.generation
+		}
+		c.remove(element)
+	}
+	recordCacheMissesTotal.Inc()
+	return TableRecord{}, false, c.generation
+}
+
+// set caches a record read from the database, unless a key was invalidated since the miss the generation
+// comes from, the record being possibly older than the write that invalidated it. The least recently used record
+// is evicted when the cache is full.
+//
+// Parameters:
+//   - key: The cache key
+//   - record: The record
+//   - generation: The generation returned by the get that missed
+func (c *recordCache) set(key string, record TableRecord, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	expiresAt := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*recordCacheEntry)
+		entry.record, entry.expiresAt = record, expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	if c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+		recordCacheEvictionsTotal.Inc()
+	}
+	c.entries[key] = c.order.PushFront(&recordCacheEntry{key: key, record: record, expiresAt: expiresAt})
+}
+
+// invalidate removes the cached records of keys, called after every write of the records, successful or not.
+//
+// Parameters:
+//   - keys: The cache keys
+func (c *recordCache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+// remove removes an element from the cache, the caller holds mu.
+func (c *recordCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*recordCacheEntry).key)
+}
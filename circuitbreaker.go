@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// errCircuitOpen is returned by the database operations while the circuit breaker is open.
+var errCircuitOpen = errorWithInfo(codes.Unavailable, reasonDatabaseOverloaded, "database overloaded, retry later", nil)
+
+// circuitState is the state of a circuit breaker.
+type circuitState int
+
+const (
+	// circuitClosed lets every operation through, counting the consecutive failures
+	circuitClosed circuitState = iota
+	// circuitOpen rejects every operation until the cooldown elapsed
+	circuitOpen
+	// circuitHalfOpen lets a single probe operation through, closing the circuit if it succeeds
+	circuitHalfOpen
+)
+
+// String returns the state name used in the logs and metrics.
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Prometheus collectors of the database circuit breaker.
+var (
+	// dbCircuitState is the current state of the breaker
+	dbCircuitState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_circuit_breaker_state",
+		Help: "State of the database circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+	// dbCircuitTransitionsTotal counts the state transitions of the breaker, labeled by the new state
+	dbCircuitTransitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_circuit_breaker_transitions_total",
+		Help: "Total number of state transitions of the database circuit breaker.",
+	}, []string{"state"})
+	// dbCircuitRejectedTotal counts the operations rejected while the breaker is open
+	dbCircuitRejectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "db_circuit_breaker_rejected_total",
+		Help: "Total number of database operations rejected by the open circuit breaker.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(dbCircuitState, dbCircuitTransitionsTotal, dbCircuitRejectedTotal)
+}
+
+// circuitBreaker stops sending operations to an overloaded database. After threshold consecutive failures it opens
+// and rejects every operation for the cooldown, then half-opens to let one probe through: the circuit closes again
+// when the probe succeeds and reopens for another cooldown when it fails.
+type circuitBreaker struct {
+	// mu protects the fields below
+	mu sync.Mutex
+	// threshold is the number of consecutive failures opening the circuit, 0 disables the breaker
+	threshold int
+	// cooldown is how long the circuit stays open before a probe is let through
+	cooldown time.Duration
+	// state is the current state
+	state circuitState
+	// failures is the number of consecutive failures while closed
+	failures int
+	// openedAt is the time the circuit last opened
+	openedAt time.Time
+	// probing reports whether the probe of the half-open circuit is in flight
+	probing bool
+}
+
+// newCircuitBreaker creates a closed circuit breaker.
+//
+// Parameters:
+//   - threshold: The number of consecutive failures opening the circuit, 0 disables the breaker
+//   - cooldown: How long the circuit stays open before a probe is let through
+//
+// Returns:
+//   - The circuit breaker
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// do runs a database operation through the breaker, rejecting it with errCircuitOpen while the circuit is open.
+// A nil breaker runs every operation.
+//
+// Parameters:
+//   - fn: The database operation
+//
+// Returns:
+//   - The error of fn, or errCircuitOpen if the operation was rejected
+func (b *circuitBreaker) do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if !b.allow() {
+		dbCircuitRejectedTotal.Inc()
+		return errCircuitOpen
+	}
+	err := fn()
+	b.record(isCircuitFailure(err))
+	return err
+}
+
+// allow reports whether an operation can run now, moving an open circuit to half-open once the cooldown elapsed.
+//
+// Returns:
+//   - true if the operation can run
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		// Only one probe at a time, the others are rejected until it completes
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of an operation let through by allow.
+//
+// Parameters:
+//   - failed: Whether the operation failed in a way showing the database is unhealthy
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+	switch b.state {
+	case circuitHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.setState(circuitClosed)
+		}
+	case circuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+// open opens the circuit for a cooldown, the caller holds mu.
+func (b *circuitBreaker) open() {
+	b.failures = 0
+	b.openedAt = time.Now()
+	b.setState(circuitOpen)
+}
+
+// setState moves the breaker to a new state, logging the transition and updating the metrics. The caller holds mu.
+//
+// Parameters:
+//   - state: The new state
+func (b *circuitBreaker) setState(state circuitState) {
+	if state == b.state {
+		return
+	}
+	switch state {
+	case circuitOpen:
+		log.Printf("Database circuit breaker %s -> open, rejecting database operations for %s", b.state, b.cooldown)
+	default:
+		log.Printf("Database circuit breaker %s -> %s", b.state, state)
+	}
+	b.state = state
+	dbCircuitState.Set(float64(state))
+	dbCircuitTransitionsTotal.WithLabelValues(state.String()).Inc()
+}
+
+// isCircuitFailure reports whether an operation error shows the database is unhealthy. The expected outcomes of a
+// healthy database, a missing record or a duplicate key, and the cancellations by the client don't count.
+//
+// Parameters:
+//   - err: The error of the operation
+//
+// Returns:
+//   - true if the error counts as a failure of the database
+func isCircuitFailure(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, context.Canceled) || isDuplicateKeyError(err) {
+		return false
+	}
+	_, isStatus := status.FromError(err)
+	return !isStatus
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// recordLookupTimeout bounds the shared query of a lookup started by a caller without deadline when
+// SERVER_METHOD_TIMEOUT is disabled, the query outliving the callers that went away.
+const recordLookupTimeout = 30 * time.Second
+
+// Prometheus collectors of the record lookup coalescing.
+var (
+	// recordLookupsExecutedTotal counts the GetRecord database queries run
+	recordLookupsExecutedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "record_lookups_executed_total",
+		Help: "Total number of record lookups that queried the database.",
+	})
+	// recordLookupsCoalescedTotal counts the GetRecord calls served by the query of a concurrent identical call
+	recordLookupsCoalescedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "record_lookups_coalesced_total",
+		Help: "Total number of record lookups that shared the database query of a concurrent identical lookup.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(recordLookupsExecutedTotal, recordLookupsCoalescedTotal)
+}
+
+// lookupRecord reads a record from the database, the concurrent lookups of the same key sharing a single query so a
+// hot key missing from the cache costs one query instead of one per caller. The query outlives a caller going away
+// while others wait for it, bounded by the deadline of the caller that started it. Without deadline it is bounded by
+// SERVER_METHOD_TIMEOUT, or recordLookupTimeout when that is disabled, so it doesn't run forever once every caller
+// went away.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - key: The cache key of the record, scoped to the tenant
+//   - a: The record key
+//
+// Returns:
+//   - The record
+//   - gorm.ErrRecordNotFound if no record has this key, the context error if the caller went away, or the error of
+//     the shared query
+func (app *Application) lookupRecord(ctx context.Context, key string, a string) (TableRecord, error) {
+	executed := false
+	results := app.recordLookups.DoChan(key, func() (result any, err error) {
+		executed = true
+		recordLookupsExecutedTotal.Inc()
+		// A panic of DoChan can't be recovered by the callers, fail the lookup instead
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("record lookup panicked: %v", r)
+			}
+		}()
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			timeout := app.config.ServerMethodTimeout
+			if timeout <= 0 {
+				timeout = recordLookupTimeout
+			}
+			deadline = time.Now().Add(timeout)
+		}
+		queryCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		defer cancel()
+		var record TableRecord
+		err = app.withRetry(queryCtx, func() error {
+			// First returns gorm.ErrRecordNotFound when no row matches
+			return app.readDB().WithContext(queryCtx).Where("a = ?", a).First(&record).Error
+		})
+		return record, err
+	})
+	select {
+	case <-ctx.Done():
+		return TableRecord{}, ctx.Err()
+	case result := <-results:
+		// The query ran before the result was sent, executed is set by then
+		if !executed {
+			recordLookupsCoalescedTotal.Inc()
+		}
+		record, _ := result.Val.(TableRecord)
+		return record, result.Err
+	}
+}
+
+// invalidateRecords invalidates the cached records of keys after a write, and detaches the lookups of them in flight
+// so the following lookups query the database again instead of sharing a query that may have read the old records.
+//
+// Parameters:
+//   - keys: The cache keys of the written records
+func (app *Application) invalidateRecords(keys ...string) {
+	app.recordCache.invalidate(keys...)
+	for _, key := range keys {
+		app.recordLookups.Forget(key)
+	}
+}
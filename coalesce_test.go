@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestLookupRecordTimeout checks that the shared query of a lookup started without deadline stops at
+// SERVER_METHOD_TIMEOUT, and that the caller going away doesn't stop it before.
+func TestLookupRecordTimeout(t *testing.T) {
+	db, mock := newMockDatabase(t)
+	app, _ := startTestServer(t, newTestConfig(t, map[string]string{"SERVER_METHOD_TIMEOUT": "100ms"}), WithDatabase(db))
+	mock.ExpectQuery("SELECT \\* FROM `table_records`").WillDelayFor(5 * time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := app.lookupRecord(ctx, "key", "key"); err != context.Canceled {
+		t.Fatalf("lookupRecord of a caller gone returned %v, want context.Canceled", err)
+	}
+	// The query shared by the callers outlives the first one, and is found again by the next caller of the key
+	if _, err := app.lookupRecord(context.Background(), "key", "key"); err == nil {
+		t.Fatal("lookupRecord returned the record of a query that should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("the shared query ran for %s, want about SERVER_METHOD_TIMEOUT", elapsed)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	// Register the gzip compressor, the server then answers the clients sending gzip compressed requests in kind
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// compressionUnaryInterceptor builds an interceptor compressing the responses of at least minSize bytes with the
+// given compressor, for the clients advertising it in their grpc-accept-encoding header. The other clients and the
+// smaller responses, which the compression would barely shrink or even grow, are sent uncompressed. The compressor
+// is selected once the handler returned, before the response headers are sent.
+//
+// Parameters:
+//   - name: The registered compressor name, such as "gzip"
+//   - minSize: The size in bytes of the smallest response compressed
+//
+// Returns:
+//   - The compression interceptor
+func compressionUnaryInterceptor(name string, minSize int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if msg, ok := resp.(proto.Message); ok && err == nil && proto.Size(msg) >= minSize {
+			setSendCompressor(ctx, name)
+		}
+		return resp, err
+	}
+}
+
+// compressionStreamInterceptor is the streaming counterpart of compressionUnaryInterceptor. The size of the messages
+// of a stream isn't known when it starts, so all of them are compressed, whatever GRPC_COMPRESSION_MIN_SIZE.
+//
+// Parameters:
+//   - name: The registered compressor name, such as "gzip"
+//
+// Returns:
+//   - The compression interceptor
+func compressionStreamInterceptor(name string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		setSendCompressor(ss.Context(), name)
+		return handler(srv, ss)
+	}
+}
+
+// setSendCompressor compresses the responses of the RPC with the given compressor when the client supports it.
+//
+// Parameters:
+//   - ctx: The context of the RPC
+//   - name: The registered compressor name
+func setSendCompressor(ctx context.Context, name string) {
+	compressors, err := grpc.ClientSupportedCompressors(ctx)
+	if err != nil {
+		return
+	}
+	for _, compressor := range compressors {
+		if compressor == name {
+			// Only fails for an unknown compressor or a non gRPC context, leaving the response uncompressed
+			_ = grpc.SetSendCompressor(ctx, name)
+			return
+		}
+	}
+}
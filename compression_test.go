@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// listRecordsResponse returns a ListRecords response of n records, the typical payload of the record methods.
+//
+// Parameters:
+//   - n: The number of records
+//
+// Returns:
+//   - The response
+func listRecordsResponse(n int) *myservice.ListRecordsResponse {
+	resp := &myservice.ListRecordsResponse{NextPageToken: "eyJhIjoia2V5LTAwMDEyMyJ9"}
+	for i := 0; i < n; i++ {
+		resp.Records = append(resp.Records, &myservice.Record{A: "key-" + strconv.Itoa(100000+i*37), B: int32(i * 7919)})
+	}
+	return resp
+}
+
+// BenchmarkCompression measures encoding a response without and with gzip for payloads on either side of
+// defaultGRPCCompressionMinSize, reporting the bytes sent on the wire and the time spent per response.
+func BenchmarkCompression(b *testing.B) {
+	gzip := encoding.GetCompressor("gzip")
+	for _, records := range []int{1, 8, 16, 32, 64, 256} {
+		resp := listRecordsResponse(records)
+		size := proto.Size(resp)
+		b.Run(fmt.Sprintf("size=%d/identity", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := proto.Marshal(resp); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size), "wire-bytes")
+		})
+		b.Run(fmt.Sprintf("size=%d/gzip", size), func(b *testing.B) {
+			var buf bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				raw, err := proto.Marshal(resp)
+				if err != nil {
+					b.Fatal(err)
+				}
+				buf.Reset()
+				w, err := gzip.Compress(&buf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.Write(raw); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len()), "wire-bytes")
+		})
+	}
+}
@@ -0,0 +1,934 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net/netip"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/joho/godotenv"
+)
+
+// Default values used when the corresponding environment variables are unset.
+const (
+	// defaultGRPCKeepaliveTime is the default for GRPC_KEEPALIVE_TIME, the gRPC recommended value
+	defaultGRPCKeepaliveTime = 2 * time.Hour
+	// defaultGRPCKeepaliveTimeout is the default for GRPC_KEEPALIVE_TIMEOUT, the gRPC recommended value
+	defaultGRPCKeepaliveTimeout = 20 * time.Second
+	// defaultGRPCKeepaliveMinTime is the default for GRPC_KEEPALIVE_MIN_TIME, the gRPC recommended value
+	defaultGRPCKeepaliveMinTime = 5 * time.Minute
+	// defaultGRPCCompressionMinSize is the default for GRPC_COMPRESSION_MIN_SIZE, see BenchmarkCompression
+	defaultGRPCCompressionMinSize = 1024
+	// defaultLogDir is the default for LOG_DIR
+	defaultLogDir = "logs"
+	// defaultLogMaxSizeMB is the default for LOG_MAX_SIZE_MB
+	defaultLogMaxSizeMB = 100
+	// defaultLogPayloadMaxBytes is the default for LOG_PAYLOAD_MAX_BYTES
+	defaultLogPayloadMaxBytes = 4096
+	// defaultListenRetryDelay is the default for LISTEN_RETRY_DELAY
+	defaultListenRetryDelay = 500 * time.Millisecond
+	// defaultPprofHost is the default for PPROF_HOST, keeping the profiles local to the machine
+	defaultPprofHost = "127.0.0.1"
+	// defaultPprofPort is the default for PPROF_PORT
+	defaultPprofPort = 6060
+	// defaultRateLimitBurst is the default for RATE_LIMIT_BURST
+	defaultRateLimitBurst = 20
+	// defaultShutdownTimeout is the default for SHUTDOWN_TIMEOUT
+	defaultShutdownTimeout = 10 * time.Second
+	// defaultShutdownStreamGrace is the default for SHUTDOWN_STREAM_GRACE
+	defaultShutdownStreamGrace = 2 * time.Second
+	// defaultShutdownHooksTimeout is the default for SHUTDOWN_HOOKS_TIMEOUT
+	defaultShutdownHooksTimeout = 5 * time.Second
+	// defaultShutdownCleanupTimeout is the default for SHUTDOWN_CLEANUP_TIMEOUT
+	defaultShutdownCleanupTimeout = 5 * time.Second
+	// defaultShutdownFlushTimeout is the default for SHUTDOWN_FLUSH_TIMEOUT
+	defaultShutdownFlushTimeout = 2 * time.Second
+	// defaultPushgatewayJob is the default for PUSHGATEWAY_JOB
+	defaultPushgatewayJob = "myservice"
+	// defaultDBMaxOpenConns is the default for DB_MAX_OPEN_CONNS
+	defaultDBMaxOpenConns = 25
+	// defaultDBMaxIdleConns is the default for DB_MAX_IDLE_CONNS
+	defaultDBMaxIdleConns = 5
+	// defaultDBConnMaxLifetime is the default for DB_CONN_MAX_LIFETIME
+	defaultDBConnMaxLifetime = 30 * time.Minute
+	// defaultDBConnMaxIdleTime is the default for DB_CONN_MAX_IDLE_TIME, below the idle timeouts of the load balancers
+	// and of the TiDB/MySQL wait_timeout
+	defaultDBConnMaxIdleTime = 5 * time.Minute
+	// defaultDBHealthcheckInterval is the default for DB_HEALTHCHECK_INTERVAL
+	defaultDBHealthcheckInterval = 10 * time.Second
+	// defaultDBPoolWaitWarnThreshold is the default for DB_POOL_WAIT_WARN_THRESHOLD
+	defaultDBPoolWaitWarnThreshold = 100 * time.Millisecond
+	// defaultDBRetryMax is the default for DB_RETRY_MAX
+	defaultDBRetryMax = 3
+	// defaultDBBreakerThreshold is the default for DB_BREAKER_THRESHOLD
+	defaultDBBreakerThreshold = 5
+	// defaultDBBreakerCooldown is the default for DB_BREAKER_COOLDOWN
+	defaultDBBreakerCooldown = 10 * time.Second
+	// defaultAPITokenSubject is the default for API_TOKEN_SUBJECT
+	defaultAPITokenSubject = "api-token"
+	// defaultCacheTTL is the default for CACHE_TTL
+	defaultCacheTTL = time.Minute
+	// defaultDBBatchSize is the default for DB_BATCH_SIZE
+	defaultDBBatchSize = 100
+	// defaultDBRetryBaseDelay is the default for DB_RETRY_BASE_DELAY
+	defaultDBRetryBaseDelay = 50 * time.Millisecond
+	// defaultGORMSlowThreshold is the default for GORM_SLOW_THRESHOLD, the GORM default
+	defaultGORMSlowThreshold = 200 * time.Millisecond
+	// defaultListDefaultPageSize is the default for LIST_DEFAULT_PAGE_SIZE
+	defaultListDefaultPageSize = 20
+	// defaultListMaxPageSize is the default for LIST_MAX_PAGE_SIZE
+	defaultListMaxPageSize = 100
+	// defaultIdempotencyTTL is the default for IDEMPOTENCY_TTL
+	defaultIdempotencyTTL = 24 * time.Hour
+	// defaultIdempotencyMaxEntries is the default for IDEMPOTENCY_MAX_ENTRIES
+	defaultIdempotencyMaxEntries = 10000
+)
+
+// Config is the typed application configuration, loaded from the environment by LoadConfig.
+type Config struct {
+	// GRPCListenPort is the port the gRPC server listens on every interface (GRPC_LISTEN_PORT)
+	GRPCListenPort int
+	// GRPCListenAddr overrides GRPCListenPort with a tcp "host:port" or a "unix:/path" address (GRPC_LISTEN_ADDR)
+	GRPCListenAddr string
+	// GRPCUnixSocketMode is the file mode of the unix socket of GRPCListenAddr, 0 keeps the mode the umask gives
+	// (GRPC_UNIX_SOCKET_MODE)
+	GRPCUnixSocketMode os.FileMode
+	// GRPCListeners is the number of tcp listeners sharing the port with SO_REUSEPORT, Linux only (GRPC_LISTENERS)
+	GRPCListeners int
+	// ListenRetryAttempts is the number of times a listen failing with "address already in use" is retried, 0 fails
+	// at once (LISTEN_RETRY_ATTEMPTS)
+	ListenRetryAttempts int
+	// ListenRetryDelay is the delay before the first listen retry, doubled for every following one (LISTEN_RETRY_DELAY)
+	ListenRetryDelay time.Duration
+	// TLSCertFile is the PEM certificate file enabling TLS (TLS_CERT_FILE)
+	TLSCertFile string
+	// TLSKeyFile is the PEM private key file of TLSCertFile (TLS_KEY_FILE)
+	TLSKeyFile string
+	// TLSClientCAFile is the PEM CA bundle client certificates are verified against, enabling mutual TLS (TLS_CLIENT_CA_FILE)
+	TLSClientCAFile string
+	// GRPCMaxRecvMsgSize is the maximum message size in bytes the server can receive, 0 keeps the gRPC default of 4MB (GRPC_MAX_RECV_MSG_SIZE)
+	GRPCMaxRecvMsgSize int
+	// GRPCMaxSendMsgSize is the maximum message size in bytes the server can send, 0 keeps the gRPC default (GRPC_MAX_SEND_MSG_SIZE)
+	GRPCMaxSendMsgSize int
+	// GRPCMaxConcurrentStreams is the maximum number of concurrent RPCs of every client connection, 0 keeps the gRPC
+	// default of no limit (GRPC_MAX_CONCURRENT_STREAMS)
+	GRPCMaxConcurrentStreams uint32
+	// GRPCKeepaliveTime is the idle time after which the server pings the client to check the connection (GRPC_KEEPALIVE_TIME)
+	GRPCKeepaliveTime time.Duration
+	// GRPCKeepaliveTimeout is how long the server waits for the ping ack before closing the connection (GRPC_KEEPALIVE_TIMEOUT)
+	GRPCKeepaliveTimeout time.Duration
+	// GRPCKeepaliveMinTime is the minimum interval allowed between client pings, faster clients are disconnected (GRPC_KEEPALIVE_MIN_TIME)
+	GRPCKeepaliveMinTime time.Duration
+	// GRPCCompression is the compressor of every response for the clients supporting it, "" or "gzip" (GRPC_COMPRESSION)
+	GRPCCompression string
+	// GRPCCompressionMinSize is the size in bytes from which GRPCCompression compresses a unary response, the
+	// smaller ones being sent uncompressed (GRPC_COMPRESSION_MIN_SIZE)
+	GRPCCompressionMinSize int
+	// EnableReflection registers gRPC server reflection (ENABLE_REFLECTION)
+	EnableReflection bool
+	// MetricsPort is the HTTP port serving Prometheus metrics, 0 disables it (METRICS_PORT)
+	MetricsPort int
+	// PushgatewayURL is the Prometheus pushgateway the metrics are pushed to when the server stops, empty disables
+	// the push (PUSHGATEWAY_URL)
+	PushgatewayURL string
+	// PushgatewayJob is the job label of the pushed metrics (PUSHGATEWAY_JOB)
+	PushgatewayJob string
+	// HealthHTTPPort is the HTTP port serving the /healthz and /readyz probes, 0 disables them (HEALTH_HTTP_PORT)
+	HealthHTTPPort int
+	// HTTPGatewayPort is the HTTP port serving the REST/JSON gateway of MyService, 0 disables it (HTTP_GATEWAY_PORT)
+	HTTPGatewayPort int
+	// GatewayTrustedProxies are the proxies in front of the gateway, as IP addresses or CIDR ranges, whose
+	// X-Forwarded-For header gives the address of the HTTP client (GATEWAY_TRUSTED_PROXIES)
+	GatewayTrustedProxies []netip.Prefix
+	// EnablePprof serves the net/http/pprof profiles on PprofHost:PprofPort (ENABLE_PPROF)
+	EnablePprof bool
+	// PprofHost is the host the pprof server binds to, localhost by default (PPROF_HOST)
+	PprofHost string
+	// PprofPort is the HTTP port of the pprof server (PPROF_PORT)
+	PprofPort int
+	// APIToken is the bearer token required on every RPC, empty disables authentication (API_TOKEN or API_TOKEN_FILE)
+	APIToken string
+	// AuthSkipMethods are the full method names that bypass authentication (AUTH_SKIP_METHODS)
+	AuthSkipMethods []string
+	// APITokenSubject is the subject of the principal authenticated by APIToken (API_TOKEN_SUBJECT)
+	APITokenSubject string
+	// APITokenScopes are the scopes granted to the principal authenticated by APIToken (API_TOKEN_SCOPES)
+	APITokenScopes []string
+	// MethodScopes are the scopes a caller needs to call a method, keyed by full method name, the methods missing
+	// from it needing none (METHOD_SCOPES)
+	MethodScopes map[string][]string
+	// RateLimitRPS is the sustained number of requests per second allowed per client IP, 0 disables it,
+	// reloaded on SIGHUP (RATE_LIMIT_RPS)
+	RateLimitRPS float64
+	// RateLimitBurst is the number of requests a client IP can make at once, reloaded on SIGHUP (RATE_LIMIT_BURST)
+	RateLimitBurst int
+	// ServerMethodTimeout caps the duration of every RPC, whatever the client deadline, 0 disables it
+	// (SERVER_METHOD_TIMEOUT)
+	ServerMethodTimeout time.Duration
+	// ServerMethodTimeouts overrides ServerMethodTimeout per full method name, 0 removing the cap of a method
+	// (SERVER_METHOD_TIMEOUTS)
+	ServerMethodTimeouts map[string]time.Duration
+	// IdempotencyTTL is how long the response of an idempotency-key is replayed, 0 disables idempotency keys
+	// (IDEMPOTENCY_TTL)
+	IdempotencyTTL time.Duration
+	// IdempotencyMaxEntries is the maximum number of responses kept by the in-memory idempotency store, the least
+	// recently used one being evicted when full (IDEMPOTENCY_MAX_ENTRIES)
+	IdempotencyMaxEntries int
+	// AuditLogPath is the file the audit events of the mutating RPCs are appended to, empty disables it
+	// (AUDIT_LOG_PATH)
+	AuditLogPath string
+	// AuditDatabase writes the audit events of the mutating RPCs to the audit_records table instead (AUDIT_DATABASE)
+	AuditDatabase bool
+
+	// ConsulAddr is the Consul agent the instance registers with, empty disables the registration (CONSUL_ADDR)
+	ConsulAddr string
+	// ServiceName is the name the instance is registered under, required with ConsulAddr (SERVICE_NAME)
+	ServiceName string
+	// ServiceAddress is the host the instance is registered with, the hostname by default (SERVICE_ADDRESS)
+	ServiceAddress string
+
+	// OTLPEndpoint is the OTLP collector receiving the traces, empty disables tracing (OTEL_EXPORTER_OTLP_ENDPOINT)
+	OTLPEndpoint string
+
+	// ShutdownTimeout is the maximum time to wait for in-flight requests and streams during graceful shutdown
+	// (SHUTDOWN_TIMEOUT)
+	ShutdownTimeout time.Duration
+	// ShutdownStreamGrace is the extra time the streams still open after ShutdownTimeout get to return once asked to,
+	// 0 closes them at once (SHUTDOWN_STREAM_GRACE)
+	ShutdownStreamGrace time.Duration
+	// ShutdownHooksTimeout is the maximum time the OnStop hooks can run during shutdown (SHUTDOWN_HOOKS_TIMEOUT)
+	ShutdownHooksTimeout time.Duration
+	// ShutdownFlushTimeout is the maximum time the OnFlush hooks can run before the drain, flushing the traces and
+	// pushing the metrics (SHUTDOWN_FLUSH_TIMEOUT)
+	ShutdownFlushTimeout time.Duration
+	// ShutdownCleanupTimeout is the maximum time to release the database connections, listeners and other resources
+	// once the server stopped (SHUTDOWN_CLEANUP_TIMEOUT)
+	ShutdownCleanupTimeout time.Duration
+	// ShutdownPredrain is the time to wait after reporting NOT_SERVING before draining connections (SHUTDOWN_PREDRAIN)
+	ShutdownPredrain time.Duration
+	// GracePeriod is the terminationGracePeriodSeconds of the pod, the time between SIGTERM and SIGKILL, SHUTDOWN_TIMEOUT
+	// being clamped so the whole shutdown fits in it, 0 when unknown (K8S_GRACE_PERIOD)
+	GracePeriod time.Duration
+
+	// LogDir is the directory of the log files (LOG_DIR)
+	LogDir string
+	// LogRequireFile fails the startup when the log file can't be opened instead of logging to stdout only
+	// (LOG_REQUIRE_FILE)
+	LogRequireFile bool
+	// LogFormat is the log line format, "text" or "json" (LOG_FORMAT)
+	LogFormat string
+	// LogTimezone is the time zone of the log file name date and of the log line timestamps, UTC by default (LOG_TIMEZONE)
+	LogTimezone *time.Location
+	// LogAsync buffers the log file writes and flushes them every second in the background (LOG_ASYNC)
+	LogAsync bool
+	// LogToStdout copies the log lines to stdout, defaults to true when running in a container (LOG_TO_STDOUT)
+	LogToStdout bool
+	// LogLevel is the minimum level of the structured log records, reloaded on SIGHUP (LOG_LEVEL)
+	LogLevel slog.Level
+	// LogMaxSizeMB is the size in megabytes after which the log file is rotated (LOG_MAX_SIZE_MB)
+	LogMaxSizeMB int
+	// LogMaxBackups is the number of rotated log files to keep, 0 keeps all (LOG_MAX_BACKUPS)
+	LogMaxBackups int
+	// LogMaxAgeDays is the number of days to keep rotated log files, 0 keeps them forever (LOG_MAX_AGE_DAYS)
+	LogMaxAgeDays int
+	// LogPayloads logs the request and response messages of every RPC as JSON, for debugging only since they can
+	// hold personal data (LOG_PAYLOADS)
+	LogPayloads bool
+	// LogPayloadRedactFields are the proto names of the message fields logged as [REDACTED] with LogPayloads
+	// (LOG_PAYLOAD_REDACT_FIELDS)
+	LogPayloadRedactFields []string
+	// LogPayloadMaxBytes is the size past which a logged payload is truncated (LOG_PAYLOAD_MAX_BYTES)
+	LogPayloadMaxBytes int
+
+	// DBEnabled connects to the database, false serves the methods that don't need one only, the others failing
+	// with codes.FailedPrecondition, and makes the database settings optional (DB_ENABLED)
+	DBEnabled bool
+	// DBDriver is the database driver, "mysql", "postgres", or "sqlite" for a self-contained local development server
+	// (DB_DRIVER)
+	DBDriver string
+	// DBDSN is the complete DSN of the database, used verbatim instead of the one built from DBHost, DBPort,
+	// DBUser, DBPassword and DBName when set (TIDB_DSN or TIDB_DSN_FILE)
+	DBDSN string
+	// DBReadDSN is the complete DSN of the read replica with DBDSN, used verbatim (TIDB_READ_DSN or TIDB_READ_DSN_FILE)
+	DBReadDSN string
+	// DBHost is the database host (TIDB_HOST)
+	DBHost string
+	// DBPort is the database port (TIDB_PORT)
+	DBPort int
+	// DBUser is the database user (TIDB_USER)
+	DBUser string
+	// DBPassword is the password of DBUser, empty for a passwordless user (TIDB_PASSWORD or TIDB_PASSWORD_FILE)
+	DBPassword string
+	// DBName is the database name (TIDB_DATABASE)
+	DBName string
+	// DBTLS encrypts the database connections with TLS, verifying the server certificate (TIDB_TLS)
+	DBTLS bool
+	// DBCAFile is the PEM CA bundle the database certificate is verified against, the system roots when empty (TIDB_CA_FILE)
+	DBCAFile string
+	// DBReadHost is the host of the read replica, empty sends reads to the primary (TIDB_READ_HOST)
+	DBReadHost string
+	// DBReadPort is the port of the read replica, defaults to DBPort (TIDB_READ_PORT)
+	DBReadPort int
+	// DBRequired makes the startup fail when the database is unreachable, otherwise the server starts without it
+	// and keeps connecting in the background (DB_REQUIRED)
+	DBRequired bool
+	// DBAutoMigrate creates or updates the table schema on startup (DB_AUTO_MIGRATE)
+	DBAutoMigrate bool
+	// DBMaxOpenConns is the maximum number of open database connections (DB_MAX_OPEN_CONNS)
+	DBMaxOpenConns int
+	// DBMaxIdleConns is the maximum number of idle database connections (DB_MAX_IDLE_CONNS)
+	DBMaxIdleConns int
+	// DBConnMaxLifetime is the maximum time a database connection is reused (DB_CONN_MAX_LIFETIME)
+	DBConnMaxLifetime time.Duration
+	// DBConnMaxIdleTime is the maximum time a database connection stays idle in the pool before it is closed,
+	// 0 keeps idle connections open (DB_CONN_MAX_IDLE_TIME)
+	DBConnMaxIdleTime time.Duration
+	// DBHealthcheckInterval is the interval of the background pings of the connected databases, flipping the health
+	// status to NOT_SERVING while they fail, 0 disables them (DB_HEALTHCHECK_INTERVAL)
+	DBHealthcheckInterval time.Duration
+	// DBPoolWaitWarnThreshold is the average wait for a free database connection over a sampling interval above
+	// which a pool starvation warning is logged, 0 disables the warning (DB_POOL_WAIT_WARN_THRESHOLD)
+	DBPoolWaitWarnThreshold time.Duration
+	// DBWarmupConns is the number of database connections opened on startup, 0 opens them on demand (DB_WARMUP_CONNS)
+	DBWarmupConns int
+	// DBPrepareStmt caches the prepared statements of every database connection, by default unless DBQueryComments
+	// is set (DB_PREPARE_STMT)
+	DBPrepareStmt bool
+	// DBQueryComments prepends a comment with the request ID and the trace ID of the RPC to every query, tracing the
+	// slow query log back to the RPCs (DB_QUERY_COMMENTS)
+	DBQueryComments bool
+	// GORMLogLevel is the level of the GORM query logs, silent, error, warn or info (GORM_LOG_LEVEL)
+	GORMLogLevel string
+	// GORMSlowThreshold is the duration above which a query is logged as slow, 0 disables it (GORM_SLOW_THRESHOLD)
+	GORMSlowThreshold time.Duration
+	// DBRetryMax is the maximum number of retries of a transient database failure (DB_RETRY_MAX)
+	DBRetryMax int
+	// DBRetryBaseDelay is the delay before the first retry, doubled for every following retry (DB_RETRY_BASE_DELAY)
+	DBRetryBaseDelay time.Duration
+	// DBBreakerThreshold is the number of consecutive database failures opening the circuit breaker, 0 disables it
+	// (DB_BREAKER_THRESHOLD)
+	DBBreakerThreshold int
+	// DBBreakerCooldown is how long the open circuit breaker rejects the database operations (DB_BREAKER_COOLDOWN)
+	DBBreakerCooldown time.Duration
+	// DBBatchSize is the number of rows written by every INSERT of the batch RPCs (DB_BATCH_SIZE)
+	DBBatchSize int
+
+	// MultiTenant requires a tenant-id metadata header on every RPC, selecting the schema of the tenant (MULTITENANT)
+	MultiTenant bool
+	// TenantSchemas are the schemas of the tenants keyed by tenant ID, the other tenants being rejected (TENANT_SCHEMAS)
+	TenantSchemas map[string]string
+
+	// FeatureFlags are the experimental behaviors turned on or off, keyed by featureFlagKey, read them with
+	// Application.Feature (FEATURE_<NAME> variables)
+	FeatureFlags map[string]bool
+
+	// CacheSize is the maximum number of records cached by GetRecord, 0 disables the cache (CACHE_SIZE)
+	CacheSize int
+	// CacheTTL is how long GetRecord serves a cached record (CACHE_TTL)
+	CacheTTL time.Duration
+
+	// RecordKeyMaxLength is the maximum length in bytes of the record keys, the a field of the requests
+	// (RECORD_KEY_MAX_LENGTH)
+	RecordKeyMaxLength int
+	// ListDefaultPageSize is the page size of the list RPCs when the request leaves it to 0 (LIST_DEFAULT_PAGE_SIZE)
+	ListDefaultPageSize int
+	// ListMaxPageSize is the maximum page size of the list RPCs, larger requested sizes are capped (LIST_MAX_PAGE_SIZE)
+	ListMaxPageSize int
+}
+
+// defaultConfigFile is the environment file loaded when CONFIG_FILES is unset.
+const defaultConfigFile = "test.env"
+
+// configFiles returns the environment files to load, in order, from the comma-separated CONFIG_FILES variable,
+// e.g. "base.env,production.env". It defaults to the single defaultConfigFile.
+//
+// Returns:
+//   - The paths of the environment files
+func configFiles() []string {
+	if paths := (&envLoader{}).list("CONFIG_FILES"); len(paths) > 0 {
+		return paths
+	}
+	return []string{defaultConfigFile}
+}
+
+// LoadConfig loads the environment files, then parses and validates every setting into a Config.
+// The files are layered in order, a variable set in a later file overriding the one of an earlier file.
+// They are optional: a missing file is skipped with a warning, and without any file the settings are read from the
+// process environment only, as in containerized deployments. Variables already set in the process environment take
+// precedence over every file. All the invalid or missing settings are reported together in the returned error.
+//
+// Parameters:
+//   - paths: The paths of the environment configuration files, from the base to the most specific one
+//
+// Returns:
+//   - The loaded configuration
+//   - An error if a file can't be loaded or a setting is missing or invalid
+func LoadConfig(paths ...string) (*Config, error) {
+	return loadConfig(paths, false)
+}
+
+// loadConfig loads the environment files, then parses and validates the settings.
+//
+// Parameters:
+//   - paths: The paths of the environment configuration files, later files overriding earlier ones
+//   - overload: Whether the file values replace the variables already set in the process environment,
+//     like godotenv.Overload, instead of leaving them untouched
+//
+// Returns:
+//   - The loaded configuration
+//   - An error if a file can't be loaded or a setting is missing or invalid
+func loadConfig(paths []string, overload bool) (*Config, error) {
+	// Merge the files first so the later files win, then apply them once
+	values := make(map[string]string)
+	for _, path := range paths {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Config file %s not found, skipped", path)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to access config file %s: %w", path, err)
+		}
+		fileValues, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+	for name, value := range values {
+		if _, set := os.LookupEnv(name); set && !overload {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+
+	env := &envLoader{}
+	cfg := &Config{
+		GRPCListenAddr:     env.string("GRPC_LISTEN_ADDR", ""),
+		GRPCListeners:      env.int("GRPC_LISTENERS", 1),
+		TLSCertFile:        env.string("TLS_CERT_FILE", ""),
+		TLSKeyFile:         env.string("TLS_KEY_FILE", ""),
+		TLSClientCAFile:    env.string("TLS_CLIENT_CA_FILE", ""),
+		GRPCMaxRecvMsgSize: env.positiveInt("GRPC_MAX_RECV_MSG_SIZE"),
+		GRPCMaxSendMsgSize: env.positiveInt("GRPC_MAX_SEND_MSG_SIZE"),
+
+		GRPCMaxConcurrentStreams: env.positiveUint32("GRPC_MAX_CONCURRENT_STREAMS"),
+		GRPCUnixSocketMode:       env.fileMode("GRPC_UNIX_SOCKET_MODE"),
+
+		ListenRetryAttempts: env.int("LISTEN_RETRY_ATTEMPTS", 0),
+		ListenRetryDelay:    env.duration("LISTEN_RETRY_DELAY", defaultListenRetryDelay),
+
+		GRPCKeepaliveTime:    env.duration("GRPC_KEEPALIVE_TIME", defaultGRPCKeepaliveTime),
+		GRPCKeepaliveTimeout: env.duration("GRPC_KEEPALIVE_TIMEOUT", defaultGRPCKeepaliveTimeout),
+		GRPCKeepaliveMinTime: env.duration("GRPC_KEEPALIVE_MIN_TIME", defaultGRPCKeepaliveMinTime),
+
+		GRPCCompression:        env.string("GRPC_COMPRESSION", ""),
+		GRPCCompressionMinSize: env.int("GRPC_COMPRESSION_MIN_SIZE", defaultGRPCCompressionMinSize),
+
+		EnableReflection: env.bool("ENABLE_REFLECTION", false),
+		MetricsPort:      env.int("METRICS_PORT", 0),
+		HealthHTTPPort:   env.int("HEALTH_HTTP_PORT", 0),
+		HTTPGatewayPort:  env.int("HTTP_GATEWAY_PORT", 0),
+		APIToken:         env.secret("API_TOKEN", ""),
+		AuthSkipMethods:  env.list("AUTH_SKIP_METHODS"),
+		APITokenSubject:  env.string("API_TOKEN_SUBJECT", defaultAPITokenSubject),
+		APITokenScopes:   env.list("API_TOKEN_SCOPES"),
+		MethodScopes:     env.fieldsMap("METHOD_SCOPES"),
+		RateLimitRPS:     env.float("RATE_LIMIT_RPS", 0),
+		RateLimitBurst:   env.int("RATE_LIMIT_BURST", defaultRateLimitBurst),
+		IdempotencyTTL:   env.duration("IDEMPOTENCY_TTL", defaultIdempotencyTTL),
+
+		IdempotencyMaxEntries: env.int("IDEMPOTENCY_MAX_ENTRIES", defaultIdempotencyMaxEntries),
+		GatewayTrustedProxies: env.prefixes("GATEWAY_TRUSTED_PROXIES"),
+
+		AuditLogPath:  env.string("AUDIT_LOG_PATH", ""),
+		AuditDatabase: env.bool("AUDIT_DATABASE", false),
+
+		ServerMethodTimeout:  env.duration("SERVER_METHOD_TIMEOUT", 0),
+		ServerMethodTimeouts: env.durationMap("SERVER_METHOD_TIMEOUTS"),
+
+		ConsulAddr:     env.string("CONSUL_ADDR", ""),
+		ServiceName:    env.string("SERVICE_NAME", ""),
+		ServiceAddress: env.string("SERVICE_ADDRESS", ""),
+
+		EnablePprof: env.bool("ENABLE_PPROF", false),
+		PprofHost:   env.string("PPROF_HOST", defaultPprofHost),
+		PprofPort:   env.int("PPROF_PORT", defaultPprofPort),
+
+		OTLPEndpoint:           env.string("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ShutdownTimeout:        env.duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
+		ShutdownStreamGrace:    env.duration("SHUTDOWN_STREAM_GRACE", defaultShutdownStreamGrace),
+		ShutdownHooksTimeout:   env.duration("SHUTDOWN_HOOKS_TIMEOUT", defaultShutdownHooksTimeout),
+		ShutdownCleanupTimeout: env.duration("SHUTDOWN_CLEANUP_TIMEOUT", defaultShutdownCleanupTimeout),
+		ShutdownPredrain:       env.duration("SHUTDOWN_PREDRAIN", 0),
+		GracePeriod:            env.duration("K8S_GRACE_PERIOD", 0),
+
+		ShutdownFlushTimeout: env.duration("SHUTDOWN_FLUSH_TIMEOUT", defaultShutdownFlushTimeout),
+		PushgatewayURL:       env.string("PUSHGATEWAY_URL", ""),
+		PushgatewayJob:       env.string("PUSHGATEWAY_JOB", defaultPushgatewayJob),
+
+		LogDir:         env.string("LOG_DIR", defaultLogDir),
+		LogRequireFile: env.bool("LOG_REQUIRE_FILE", false),
+		LogFormat:      env.string("LOG_FORMAT", "text"),
+		LogTimezone:    env.location("LOG_TIMEZONE", time.UTC),
+		LogLevel:       env.level("LOG_LEVEL", slog.LevelInfo),
+		LogAsync:       env.bool("LOG_ASYNC", false),
+		LogToStdout:    env.bool("LOG_TO_STDOUT", runningInContainer()),
+		LogMaxSizeMB:   env.int("LOG_MAX_SIZE_MB", defaultLogMaxSizeMB),
+		LogMaxBackups:  env.int("LOG_MAX_BACKUPS", 0),
+		LogMaxAgeDays:  env.int("LOG_MAX_AGE_DAYS", 0),
+
+		LogPayloads:            env.bool("LOG_PAYLOADS", false),
+		LogPayloadRedactFields: env.list("LOG_PAYLOAD_REDACT_FIELDS"),
+		LogPayloadMaxBytes:     env.int("LOG_PAYLOAD_MAX_BYTES", defaultLogPayloadMaxBytes),
+
+		DBEnabled:         env.bool("DB_ENABLED", true),
+		DBDriver:          env.string("DB_DRIVER", "mysql"),
+		DBDSN:             env.secret("TIDB_DSN", ""),
+		DBReadDSN:         env.secret("TIDB_READ_DSN", ""),
+		DBHost:            env.string("TIDB_HOST", ""),
+		DBUser:            env.string("TIDB_USER", ""),
+		DBPassword:        env.secret("TIDB_PASSWORD", ""),
+		DBName:            env.string("TIDB_DATABASE", ""),
+		DBTLS:             env.bool("TIDB_TLS", false),
+		DBCAFile:          env.string("TIDB_CA_FILE", ""),
+		DBRequired:        env.bool("DB_REQUIRED", true),
+		DBAutoMigrate:     env.bool("DB_AUTO_MIGRATE", true),
+		DBMaxOpenConns:    env.int("DB_MAX_OPEN_CONNS", defaultDBMaxOpenConns),
+		DBMaxIdleConns:    env.int("DB_MAX_IDLE_CONNS", defaultDBMaxIdleConns),
+		DBConnMaxLifetime: env.duration("DB_CONN_MAX_LIFETIME", defaultDBConnMaxLifetime),
+		DBConnMaxIdleTime: env.duration("DB_CONN_MAX_IDLE_TIME", defaultDBConnMaxIdleTime),
+		DBWarmupConns:     env.int("DB_WARMUP_CONNS", 0),
+
+		DBHealthcheckInterval:   env.duration("DB_HEALTHCHECK_INTERVAL", defaultDBHealthcheckInterval),
+		DBPoolWaitWarnThreshold: env.duration("DB_POOL_WAIT_WARN_THRESHOLD", defaultDBPoolWaitWarnThreshold),
+
+		DBPrepareStmt:     env.bool("DB_PREPARE_STMT", true),
+		GORMLogLevel:      env.string("GORM_LOG_LEVEL", "warn"),
+		GORMSlowThreshold: env.duration("GORM_SLOW_THRESHOLD", defaultGORMSlowThreshold),
+
+		DBQueryComments:  env.bool("DB_QUERY_COMMENTS", false),
+		DBRetryMax:       env.int("DB_RETRY_MAX", defaultDBRetryMax),
+		DBRetryBaseDelay: env.duration("DB_RETRY_BASE_DELAY", defaultDBRetryBaseDelay),
+		DBBatchSize:      env.int("DB_BATCH_SIZE", defaultDBBatchSize),
+
+		DBBreakerThreshold: env.int("DB_BREAKER_THRESHOLD", defaultDBBreakerThreshold),
+		DBBreakerCooldown:  env.duration("DB_BREAKER_COOLDOWN", defaultDBBreakerCooldown),
+
+		MultiTenant:   env.bool("MULTITENANT", false),
+		TenantSchemas: env.stringMap("TENANT_SCHEMAS"),
+
+		FeatureFlags: newFeatureFlags(env.boolsWithPrefix(featureFlagPrefix)),
+
+		CacheSize: env.int("CACHE_SIZE", 0),
+		CacheTTL:  env.duration("CACHE_TTL", defaultCacheTTL),
+
+		RecordKeyMaxLength:  env.int("RECORD_KEY_MAX_LENGTH", recordKeyColumnSize),
+		ListDefaultPageSize: env.int("LIST_DEFAULT_PAGE_SIZE", defaultListDefaultPageSize),
+		ListMaxPageSize:     env.int("LIST_MAX_PAGE_SIZE", defaultListMaxPageSize),
+	}
+	// The query comments make a new statement text per request, so they turn the statement cache off unless
+	// DB_PREPARE_STMT is set explicitly, which validate then rejects
+	if cfg.DBQueryComments && os.Getenv("DB_PREPARE_STMT") == "" {
+		cfg.DBPrepareStmt = false
+	}
+	// The port is only required when no explicit listen address is configured
+	if cfg.GRPCListenAddr == "" {
+		env.required("GRPC_LISTEN_PORT")
+	}
+	cfg.GRPCListenPort = env.int("GRPC_LISTEN_PORT", 0)
+	// The database settings are only required when the database is enabled without a complete DSN,
+	// SQLite defaulting to an in-memory database
+	if cfg.DBEnabled && cfg.DBDSN == "" && cfg.DBDriver != "sqlite" {
+		env.required("TIDB_HOST")
+		env.required("TIDB_USER")
+		env.required("TIDB_DATABASE")
+		env.required("TIDB_PORT")
+	}
+	cfg.DBPort = env.int("TIDB_PORT", 0)
+	cfg.DBReadHost = env.string("TIDB_READ_HOST", "")
+	cfg.DBReadPort = env.int("TIDB_READ_PORT", cfg.DBPort)
+
+	if err := errors.Join(env.err(), cfg.validate()); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// validate checks the settings that depend on each other or accept a fixed set of values.
+//
+// Returns:
+//   - An error describing every invalid setting, nil if the configuration is valid
+func (cfg *Config) validate() error {
+	var errs []error
+	if network, _ := cfg.listenAddress(); cfg.GRPCUnixSocketMode != 0 && network != "unix" {
+		errs = append(errs, errors.New("GRPC_UNIX_SOCKET_MODE requires a unix: GRPC_LISTEN_ADDR"))
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		errs = append(errs, errors.New("both TLS_CERT_FILE and TLS_KEY_FILE must be set to enable TLS"))
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		errs = append(errs, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE"))
+	}
+	if cfg.TLSClientCAFile != "" && cfg.HTTPGatewayPort != 0 {
+		// The gateway has no client certificate to present, it would bypass the mutual TLS authentication
+		errs = append(errs, errors.New("HTTP_GATEWAY_PORT can't be used with TLS_CLIENT_CA_FILE"))
+	}
+	// Only the drain is clamped to the grace period, the other phases must leave it some time
+	if fixed := cfg.shutdownDuration() - cfg.ShutdownTimeout; cfg.GracePeriod > 0 && fixed >= cfg.GracePeriod-gracePeriodMargin {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_HOOKS_TIMEOUT, SHUTDOWN_PREDRAIN, SHUTDOWN_FLUSH_TIMEOUT, SHUTDOWN_STREAM_GRACE and SHUTDOWN_CLEANUP_TIMEOUT "+
+			"add up to %s, leaving no time to drain within K8S_GRACE_PERIOD %s less a %s margin", fixed, cfg.GracePeriod, gracePeriodMargin))
+	}
+	if cfg.AuditLogPath != "" && cfg.AuditDatabase {
+		errs = append(errs, errors.New("AUDIT_LOG_PATH and AUDIT_DATABASE can't be used together"))
+	}
+	if cfg.AuditDatabase && !cfg.DBEnabled {
+		errs = append(errs, errors.New("AUDIT_DATABASE requires DB_ENABLED"))
+	}
+	if len(cfg.MethodScopes) > 0 && cfg.APIToken == "" {
+		// Without authentication there is no principal, every listed method would be denied
+		errs = append(errs, errors.New("METHOD_SCOPES requires API_TOKEN"))
+	}
+	for _, method := range cfg.AuthSkipMethods {
+		if _, ok := cfg.MethodScopes[method]; ok {
+			errs = append(errs, fmt.Errorf("METHOD_SCOPES method %s is in AUTH_SKIP_METHODS, its callers have no scope", method))
+		}
+	}
+	if cfg.PushgatewayURL != "" && cfg.PushgatewayJob == "" {
+		errs = append(errs, errors.New("PUSHGATEWAY_JOB is required when PUSHGATEWAY_URL is set"))
+	}
+	if cfg.ConsulAddr != "" && cfg.ServiceName == "" {
+		errs = append(errs, errors.New("SERVICE_NAME is required when CONSUL_ADDR is set"))
+	}
+	if network, _ := cfg.listenAddress(); cfg.ConsulAddr != "" && network != "tcp" {
+		errs = append(errs, errors.New("CONSUL_ADDR requires a tcp GRPC_LISTEN_ADDR"))
+	}
+	if cfg.EnablePprof {
+		for _, port := range []int{cfg.MetricsPort, cfg.HealthHTTPPort, cfg.HTTPGatewayPort} {
+			if port == cfg.PprofPort {
+				// The profiles get a server of their own, bound to PPROF_HOST only
+				errs = append(errs, fmt.Errorf("PPROF_PORT %d is already used by another HTTP server", cfg.PprofPort))
+				break
+			}
+		}
+	}
+	if cfg.ListenRetryAttempts > 0 && cfg.ListenRetryDelay <= 0 {
+		errs = append(errs, errors.New("LISTEN_RETRY_DELAY must be positive when LISTEN_RETRY_ATTEMPTS is set"))
+	}
+	if cfg.GRPCListeners < 1 {
+		errs = append(errs, errors.New("GRPC_LISTENERS must be at least 1"))
+	}
+	if cfg.RateLimitRPS > 0 && cfg.RateLimitBurst < 1 {
+		errs = append(errs, errors.New("RATE_LIMIT_BURST must be at least 1 when RATE_LIMIT_RPS is set"))
+	}
+	if cfg.IdempotencyTTL < 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_TTL must not be negative"))
+	}
+	if cfg.IdempotencyTTL > 0 && cfg.IdempotencyMaxEntries < 1 {
+		errs = append(errs, errors.New("IDEMPOTENCY_MAX_ENTRIES must be at least 1 when IDEMPOTENCY_TTL is set"))
+	}
+	if cfg.DBBreakerThreshold > 0 && cfg.DBBreakerCooldown <= 0 {
+		errs = append(errs, errors.New("DB_BREAKER_COOLDOWN must be positive when DB_BREAKER_THRESHOLD is set"))
+	}
+	if cfg.DBWarmupConns > cfg.DBMaxIdleConns {
+		// The connections above the idle limit would be closed right after the warmup
+		errs = append(errs, errors.New("DB_WARMUP_CONNS must not exceed DB_MAX_IDLE_CONNS"))
+	}
+	if cfg.DBBatchSize < 1 {
+		errs = append(errs, errors.New("DB_BATCH_SIZE must be at least 1"))
+	}
+	if cfg.RecordKeyMaxLength < 1 {
+		errs = append(errs, errors.New("RECORD_KEY_MAX_LENGTH must be at least 1"))
+	}
+	if cfg.DBAutoMigrate && cfg.RecordKeyMaxLength > recordKeyColumnSize {
+		// Longer keys would fail the insert in the migrated column, widen it with your own migration first
+		errs = append(errs, fmt.Errorf("RECORD_KEY_MAX_LENGTH must be at most %d, the size of the migrated column, when DB_AUTO_MIGRATE is set", recordKeyColumnSize))
+	}
+	if cfg.MultiTenant {
+		if !cfg.DBEnabled {
+			errs = append(errs, errors.New("MULTITENANT requires DB_ENABLED"))
+		}
+		if len(cfg.TenantSchemas) == 0 {
+			errs = append(errs, errors.New("TENANT_SCHEMAS is required when MULTITENANT is set"))
+		}
+		for tenant, schema := range cfg.TenantSchemas {
+			// The schema is written into the SQL statements, it can't be a bound parameter
+			if !schemaNamePattern.MatchString(schema) {
+				errs = append(errs, fmt.Errorf("TENANT_SCHEMAS schema of tenant %q must be letters, digits and underscores, got %q", tenant, schema))
+			}
+		}
+	}
+	if cfg.CacheSize < 0 {
+		errs = append(errs, errors.New("CACHE_SIZE must not be negative"))
+	}
+	if cfg.CacheSize > 0 && cfg.CacheTTL <= 0 {
+		errs = append(errs, errors.New("CACHE_TTL must be positive when CACHE_SIZE is set"))
+	}
+	if cfg.ListMaxPageSize < 1 {
+		errs = append(errs, errors.New("LIST_MAX_PAGE_SIZE must be at least 1"))
+	}
+	if cfg.ListDefaultPageSize < 1 || cfg.ListDefaultPageSize > cfg.ListMaxPageSize {
+		errs = append(errs, errors.New("LIST_DEFAULT_PAGE_SIZE must be between 1 and LIST_MAX_PAGE_SIZE"))
+	}
+	switch cfg.GRPCCompression {
+	case "", "gzip":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported GRPC_COMPRESSION %q, expected gzip or empty", cfg.GRPCCompression))
+	}
+	if cfg.GRPCCompressionMinSize < 0 {
+		errs = append(errs, errors.New("GRPC_COMPRESSION_MIN_SIZE must not be negative"))
+	}
+	switch cfg.LogFormat {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported LOG_FORMAT %q, expected text or json", cfg.LogFormat))
+	}
+	if cfg.LogPayloads && cfg.LogPayloadMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("LOG_PAYLOAD_MAX_BYTES must be positive, got %d", cfg.LogPayloadMaxBytes))
+	}
+	if cfg.DBCAFile != "" && !cfg.DBTLS {
+		errs = append(errs, errors.New("TIDB_CA_FILE requires TIDB_TLS=true"))
+	}
+	if cfg.DBDSN != "" {
+		// The DSN is used verbatim, the settings the template would add to it have to be in it already
+		if cfg.DBTLS {
+			errs = append(errs, errors.New("TIDB_TLS can't be used with TIDB_DSN, set the TLS parameters in the DSN"))
+		}
+		if cfg.DBReadHost != "" {
+			errs = append(errs, errors.New("TIDB_READ_HOST can't be used with TIDB_DSN, set TIDB_READ_DSN instead"))
+		}
+		if cfg.DBDriver == "mysql" {
+			errs = append(errs, validateMySQLDSN("TIDB_DSN", cfg.DBDSN), validateMySQLDSN("TIDB_READ_DSN", cfg.DBReadDSN))
+		}
+	} else if cfg.DBReadDSN != "" {
+		errs = append(errs, errors.New("TIDB_READ_DSN requires TIDB_DSN"))
+	}
+	if cfg.DBQueryComments && cfg.DBPrepareStmt {
+		// Every request ID makes a new statement text, each one would be prepared and cached once per connection
+		errs = append(errs, errors.New("DB_QUERY_COMMENTS requires DB_PREPARE_STMT=false"))
+	}
+	if _, ok := gormLogLevels[cfg.GORMLogLevel]; !ok {
+		errs = append(errs, fmt.Errorf("unsupported GORM_LOG_LEVEL %q, expected silent, error, warn or info", cfg.GORMLogLevel))
+	}
+	switch cfg.DBDriver {
+	case "mysql", "postgres":
+	case "sqlite":
+		// The SQLite database is a local file or in memory, there is no server to encrypt, replicate or split
+		if cfg.DBTLS {
+			errs = append(errs, errors.New("TIDB_TLS can't be used with DB_DRIVER=sqlite"))
+		}
+		if cfg.DBReadHost != "" || cfg.DBReadDSN != "" {
+			errs = append(errs, errors.New("a read replica can't be used with DB_DRIVER=sqlite"))
+		}
+		if cfg.MultiTenant {
+			errs = append(errs, errors.New("MULTITENANT can't be used with DB_DRIVER=sqlite"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported DB_DRIVER %q, expected mysql, postgres or sqlite", cfg.DBDriver))
+	}
+	ports := []struct {
+		name  string
+		value int
+	}{
+		{"GRPC_LISTEN_PORT", cfg.GRPCListenPort},
+		{"METRICS_PORT", cfg.MetricsPort},
+		{"HEALTH_HTTP_PORT", cfg.HealthHTTPPort},
+		{"HTTP_GATEWAY_PORT", cfg.HTTPGatewayPort},
+		{"PPROF_PORT", cfg.PprofPort},
+		{"TIDB_PORT", cfg.DBPort},
+		{"TIDB_READ_PORT", cfg.DBReadPort},
+	}
+	for _, port := range ports {
+		if port.value > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a valid port, got %d", port.name, port.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apiTokenPrincipal returns the principal authenticated by the API_TOKEN bearer token.
+//
+// Returns:
+//   - The principal
+func (cfg *Config) apiTokenPrincipal() Principal {
+	return Principal{Subject: cfg.APITokenSubject, Scopes: cfg.APITokenScopes}
+}
+
+// validateMySQLDSN checks a MySQL DSN used verbatim, which must set parseTime=true for the time columns of the
+// records to be scanned. The DSN itself isn't part of the error, it carries the password.
+//
+// Parameters:
+//   - name: The variable the DSN comes from
+//   - dsn: The DSN, empty when unset
+//
+// Returns:
+//   - An error if the DSN can't be parsed or doesn't set parseTime=true, nil otherwise
+func validateMySQLDSN(name string, dsn string) error {
+	if dsn == "" {
+		return nil
+	}
+	parsed, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid MySQL DSN: %w", name, err)
+	}
+	if !parsed.ParseTime {
+		return fmt.Errorf("%s must set parseTime=true", name)
+	}
+	return nil
+}
+
+// runningInContainer reports whether the process looks like it runs in a container,
+// from the marker files of Docker and Podman or the variables Kubernetes sets in every pod.
+//
+// Returns:
+//   - true if a container runtime was detected
+func runningInContainer() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// secretSettingPattern matches the names of the Config fields redacted from the configuration summaries, such as
+// APIToken, DBPassword and DBDSN, a DSN carrying the password. Only the name suffix counts, the settings describing
+// a secret such as APITokenSubject and APITokenScopes aren't secrets themselves.
+var secretSettingPattern = regexp.MustCompile(`(Password|Token|Secret|DSN)$`)
+
+// configSetting is a resolved setting of the configuration summaries.
+type configSetting struct {
+	// name is the Config field name
+	name string
+	// value is the field value, "<redacted>" for a secret one that is set
+	value any
+}
+
+// settings returns every resolved setting in field order, redacting the secret ones.
+//
+// Returns:
+//   - The settings
+func (cfg *Config) settings() []configSetting {
+	value := reflect.ValueOf(cfg).Elem()
+	settings := make([]configSetting, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		field := value.Field(i).Interface()
+		if secretSettingPattern.MatchString(name) && !value.Field(i).IsZero() {
+			field = "<redacted>"
+		}
+		settings = append(settings, configSetting{name: name, value: field})
+	}
+	return settings
+}
+
+// writeSummary writes every resolved setting on its own line as "Name: value", redacting the secret ones.
+//
+// Parameters:
+//   - w: The writer receiving the summary
+func (cfg *Config) writeSummary(w io.Writer) {
+	for _, setting := range cfg.settings() {
+		fmt.Fprintf(w, "%s: %v\n", setting.name, setting.value)
+	}
+}
+
+// features returns the names of the optional features enabled by the configuration.
+//
+// Returns:
+//   - The enabled features, in a fixed order
+func (cfg *Config) features() []string {
+	enabled := []struct {
+		name string
+		on   bool
+	}{
+		{"database", cfg.DBEnabled},
+		{"read_replica", cfg.DBEnabled && (cfg.DBReadHost != "" || cfg.DBReadDSN != "")},
+		{"tls", cfg.TLSCertFile != ""},
+		{"mtls", cfg.TLSClientCAFile != ""},
+		{"auth", cfg.APIToken != ""},
+		{"method_scopes", len(cfg.MethodScopes) > 0},
+		{"rate_limit", cfg.RateLimitRPS > 0},
+		{"idempotency", cfg.IdempotencyTTL > 0},
+		{"method_timeouts", cfg.ServerMethodTimeout > 0 || len(cfg.ServerMethodTimeouts) > 0},
+		{"compression", cfg.GRPCCompression != ""},
+		{"reflection", cfg.EnableReflection},
+		{"metrics", cfg.MetricsPort != 0},
+		{"http_probes", cfg.HealthHTTPPort != 0},
+		{"gateway", cfg.HTTPGatewayPort != 0},
+		{"tracing", cfg.OTLPEndpoint != ""},
+		{"pushgateway", cfg.PushgatewayURL != ""},
+		{"pprof", cfg.EnablePprof},
+		{"consul", cfg.ConsulAddr != ""},
+		{"db_circuit_breaker", cfg.DBEnabled && cfg.DBBreakerThreshold > 0},
+		{"db_query_comments", cfg.DBEnabled && cfg.DBQueryComments},
+		{"multitenant", cfg.MultiTenant},
+		{"record_cache", cfg.CacheSize > 0},
+		{"payload_logging", cfg.LogPayloads},
+		{"audit_log", cfg.AuditLogPath != "" || cfg.AuditDatabase},
+	}
+	var names []string
+	for _, feature := range enabled {
+		if feature.on {
+			names = append(names, feature.name)
+		}
+	}
+	return names
+}
+
+// logStartup logs the one-time "startup" event with the listen address, the enabled features and every resolved
+// setting, the secret ones redacted, so operators can check which configuration a deployment runs with from a
+// single line.
+//
+// Parameters:
+//   - logger: The structured logger
+func (cfg *Config) logStartup(logger *slog.Logger) {
+	network, address := cfg.listenAddress()
+	attrs := []slog.Attr{
+		slog.String("listen", network+" "+address),
+		slog.String("features", strings.Join(cfg.features(), ",")),
+	}
+	for _, setting := range cfg.settings() {
+		switch value := setting.value.(type) {
+		case string, bool, int, uint32, float64:
+			attrs = append(attrs, slog.Any(setting.name, value))
+		default:
+			// Durations, levels, locations, lists and maps, as printed by writeSummary
+			attrs = append(attrs, slog.String(setting.name, fmt.Sprint(value)))
+		}
+	}
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "startup", attrs...)
+}
+
+// listenAddress resolves the network and address the gRPC server listens on.
+// GRPCListenAddr is used verbatim when set, either as a tcp "host:port" or as a unix socket "unix:/path".
+// Otherwise the server listens on all interfaces on GRPCListenPort.
+//
+// Returns:
+//   - The network, "tcp" or "unix"
+//   - The address to pass to net.Listen
+func (cfg *Config) listenAddress() (string, string) {
+	if cfg.GRPCListenAddr == "" {
+		return "tcp", ":" + strconv.Itoa(cfg.GRPCListenPort)
+	}
+	if path, ok := strings.CutPrefix(cfg.GRPCListenAddr, "unix:"); ok {
+		// Accept both unix:/path and unix:///path
+		return "unix", strings.TrimPrefix(path, "//")
+	}
+	return "tcp", strings.TrimPrefix(cfg.GRPCListenAddr, "tcp://")
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+// TestSettingsRedaction checks that the configuration summaries redact the secret settings that are set, and only
+// them, the settings describing a secret being logged as is.
+func TestSettingsRedaction(t *testing.T) {
+	cfg := &Config{
+		APIToken:        "token",
+		APITokenSubject: "ci",
+		APITokenScopes:  []string{"records:read"},
+		DBPassword:      "password",
+		DBDSN:           "user:password@tcp(db:4000)/test",
+		TLSKeyFile:      "/etc/tls/server.key",
+	}
+	want := map[string]any{
+		"APIToken":        "<redacted>",
+		"APITokenSubject": "ci",
+		"DBPassword":      "<redacted>",
+		"DBDSN":           "<redacted>",
+		// Unset, nothing to hide
+		"DBReadDSN":  "",
+		"TLSKeyFile": "/etc/tls/server.key",
+	}
+	settings := make(map[string]any)
+	for _, setting := range cfg.settings() {
+		settings[setting.name] = setting.value
+	}
+	for name, value := range want {
+		if settings[name] != value {
+			t.Errorf("%s = %v, want %v", name, settings[name], value)
+		}
+	}
+	if scopes, ok := settings["APITokenScopes"].([]string); !ok || len(scopes) != 1 || scopes[0] != "records:read" {
+		t.Errorf("APITokenScopes = %v, want [records:read]", settings["APITokenScopes"])
+	}
+}
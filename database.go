@@ -0,0 +1,669 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// dbPingTimeout bounds the database ping performed when connecting.
+const dbPingTimeout = 5 * time.Second
+
+// dbReconnectInterval is the delay between two connection attempts of the background reconnection.
+const dbReconnectInterval = 5 * time.Second
+
+// errDatabaseUnavailable is returned by the handlers while the database is not connected yet.
+var errDatabaseUnavailable = errorWithInfo(codes.Unavailable, reasonDatabaseUnavailable, "database unavailable", nil)
+
+// errDatabaseDisabled is returned by the handlers needing the database when DB_ENABLED=false.
+var errDatabaseDisabled = errorWithInfo(codes.FailedPrecondition, reasonDatabaseDisabled, "database disabled on this server", nil)
+
+// errApplicationStopped is returned by connectDatabases once stop released the resources, the new connections being
+// closed instead of registered.
+var errApplicationStopped = errors.New("application stopped")
+
+// sqliteMemoryDSN is the DSN of the in-memory SQLite database used without TIDB_DSN, lost when the server stops.
+const sqliteMemoryDSN = "file::memory:"
+
+// dbTLSConfigName is the name the database TLS configuration is registered under with the mysql driver.
+const dbTLSConfigName = "custom"
+
+// dbEndpoint is the database server a connection is opened to, from a complete DSN or a host and port.
+type dbEndpoint struct {
+	// dsn is the complete DSN, used verbatim, empty to build it from the host, the port and the other settings
+	dsn string
+	// host is the database host
+	host string
+	// port is the database port
+	port int
+	// label names the endpoint in the logs, the host and port or the variable of the DSN, which carries the password
+	label string
+}
+
+// hostEndpoint returns the endpoint of a database server at host:port.
+//
+// Parameters:
+//   - host: The database host
+//   - port: The database port
+//
+// Returns:
+//   - The endpoint
+func hostEndpoint(host string, port int) dbEndpoint {
+	return dbEndpoint{host: host, port: port, label: net.JoinHostPort(host, strconv.Itoa(port))}
+}
+
+// dsnEndpoint returns the endpoint of a database server reached with a complete DSN.
+//
+// Parameters:
+//   - name: The variable the DSN comes from, e.g. TIDB_DSN
+//   - dsn: The DSN
+//
+// Returns:
+//   - The endpoint
+func dsnEndpoint(name string, dsn string) dbEndpoint {
+	return dbEndpoint{dsn: dsn, label: name}
+}
+
+// primaryEndpoint returns the endpoint of the primary database, TIDB_DSN when set and TIDB_HOST:TIDB_PORT otherwise,
+// or an in-memory database with SQLite.
+//
+// Returns:
+//   - The endpoint
+func (cfg *Config) primaryEndpoint() dbEndpoint {
+	if cfg.DBDSN != "" {
+		return dsnEndpoint("TIDB_DSN", cfg.DBDSN)
+	}
+	if cfg.DBDriver == "sqlite" {
+		return dsnEndpoint("in-memory sqlite", sqliteMemoryDSN)
+	}
+	return hostEndpoint(cfg.DBHost, cfg.DBPort)
+}
+
+// readEndpoint returns the endpoint of the read replica, TIDB_READ_DSN with TIDB_DSN and
+// TIDB_READ_HOST:TIDB_READ_PORT otherwise.
+//
+// Returns:
+//   - The endpoint
+//   - false when no read replica is configured
+func (cfg *Config) readEndpoint() (dbEndpoint, bool) {
+	if cfg.DBReadDSN != "" {
+		return dsnEndpoint("TIDB_READ_DSN", cfg.DBReadDSN), true
+	}
+	if cfg.DBReadHost != "" {
+		return hostEndpoint(cfg.DBReadHost, cfg.DBReadPort), true
+	}
+	return dbEndpoint{}, false
+}
+
+// newDialector builds the GORM dialector for the configured database driver. The DSN of the endpoint is used
+// verbatim when set, otherwise it is built from the settings: with TIDB_TLS, the connection is encrypted and the
+// server certificate verified against TIDB_CA_FILE, or the system roots when it is empty.
+//
+// Parameters:
+//   - cfg: The application configuration
+//   - endpoint: The database server
+//
+// Returns:
+//   - The GORM dialector for the driver
+//   - An error if the driver is not supported or the CA file can't be loaded
+func newDialector(cfg *Config, endpoint dbEndpoint) (gorm.Dialector, error) {
+	host, port := endpoint.host, endpoint.port
+	switch cfg.DBDriver {
+	case "mysql":
+		if endpoint.dsn != "" {
+			return gormmysql.Open(endpoint.dsn), nil
+		}
+		// TiDB speaks the MySQL protocol. The driver takes the password verbatim up to the last @ of the DSN,
+		// FormatDSN handles any special character
+		mysqlConfig := mysql.NewConfig()
+		mysqlConfig.User = cfg.DBUser
+		mysqlConfig.Passwd = cfg.DBPassword
+		mysqlConfig.Net = "tcp"
+		mysqlConfig.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+		mysqlConfig.DBName = cfg.DBName
+		mysqlConfig.ParseTime = true
+		if cfg.DBTLS {
+			tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+			if cfg.DBCAFile != "" {
+				rootCAs, err := loadCertPool(cfg.DBCAFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load TIDB_CA_FILE: %w", err)
+				}
+				tlsConfig.RootCAs = rootCAs
+			}
+			// The driver verifies the certificate against the host of each connection, primary or replica
+			if err := mysql.RegisterTLSConfig(dbTLSConfigName, tlsConfig); err != nil {
+				return nil, fmt.Errorf("failed to register database TLS config: %w", err)
+			}
+			mysqlConfig.TLSConfig = dbTLSConfigName
+		}
+		return gormmysql.Open(mysqlConfig.FormatDSN()), nil
+	case "postgres":
+		if endpoint.dsn != "" {
+			return postgres.Open(endpoint.dsn), nil
+		}
+		dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s", host, port, cfg.DBUser, cfg.DBName)
+		if cfg.DBPassword != "" {
+			dsn += " password=" + quotePostgresValue(cfg.DBPassword)
+		}
+		if cfg.DBTLS {
+			dsn += " sslmode=verify-full"
+			if cfg.DBCAFile != "" {
+				dsn += " sslrootcert=" + cfg.DBCAFile
+			}
+		}
+		return postgres.Open(dsn), nil
+	case "sqlite":
+		return sqlite.Open(endpoint.dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q, expected mysql, postgres or sqlite", cfg.DBDriver)
+	}
+}
+
+// quotePostgresValue quotes a value of a PostgreSQL keyword/value connection string,
+// escaping the backslashes and single quotes so passwords with spaces or quotes are passed verbatim.
+//
+// Parameters:
+//   - value: The raw value
+//
+// Returns:
+//   - The quoted value
+func quotePostgresValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// openDatabase connects to the database at endpoint, configures its connection pool, and pings it
+// so a wrong host fails at startup instead of on the first query. The connection is closed on failure,
+// the caller registers the returned one to be closed in stop.
+//
+// Parameters:
+//   - name: The connection name used in the logs
+//   - endpoint: The database server
+//
+// Returns:
+//   - The database connection
+//   - An error if the connection or the ping failed
+func (app *Application) openDatabase(name string, endpoint dbEndpoint) (*gorm.DB, error) {
+	cfg := app.config
+	// Select the database dialector for the configured driver
+	dialector, err := newDialector(cfg, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: newGormLogger(cfg.GORMLogLevel, cfg.GORMSlowThreshold),
+		// Prepare every statement once per connection and reuse it for the following queries
+		PrepareStmt: cfg.DBPrepareStmt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s at %s: %w", name, endpoint.label, err)
+	}
+	// Send the queries of every request to the schema of its tenant
+	if cfg.MultiTenant {
+		if err := registerTenantScope(db); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DBQueryComments {
+		if err := registerQueryComments(db); err != nil {
+			return nil, err
+		}
+	}
+	// Configure the connection pool of the underlying sql.DB
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access %s connection pool: %w", name, err)
+	}
+	if cfg.DBDriver == "sqlite" {
+		// Every connection to the in-memory database opens a new empty one, and SQLite has a single writer anyway:
+		// keep one connection open for the lifetime of the server
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+		log.Printf("%s pool configured: a single sqlite connection, the DB_* pool settings are ignored", name)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+		sqlDB.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+		// Close the idle connections before the server or a load balancer drops them, the next query on such a
+		// connection would fail with "invalid connection"
+		sqlDB.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+		log.Printf("%s pool configured: max_open_conns=%d max_idle_conns=%d conn_max_lifetime=%s conn_max_idle_time=%s",
+			name, cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime, cfg.DBConnMaxIdleTime)
+	}
+	// Ping the database so a wrong host fails at startup instead of on the first query
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to ping %s at %s: %w", name, endpoint.label, err)
+	}
+	// Open the warmup connections now so the first requests don't pay for the connection setup
+	if cfg.DBWarmupConns > 0 && cfg.DBDriver != "sqlite" {
+		if err := warmupDatabase(ctx, sqlDB, cfg.DBWarmupConns); err != nil {
+			// The pool opens the missing connections on demand, the server works without the warmup
+			log.Printf("%s warmup incomplete: %v", name, err)
+		} else {
+			log.Printf("%s warmed up with %d connections", name, cfg.DBWarmupConns)
+		}
+	}
+	return db, nil
+}
+
+// warmupDatabase opens n connections of the pool at once and runs SELECT 1 on each before releasing them,
+// so they stay idle in the pool, DB_MAX_IDLE_CONNS allowing, ready for the first requests.
+//
+// Parameters:
+//   - ctx: The context bounding the warmup
+//   - sqlDB: The connection pool
+//   - n: The number of connections to open
+//
+// Returns:
+//   - An error if a connection couldn't be opened or didn't answer, the other ones are released anyway
+func warmupDatabase(ctx context.Context, sqlDB *sql.DB, n int) error {
+	// Hold every connection until all of them answered, otherwise the pool would hand the same one out again
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to open connection %d: %w", i+1, err)
+		}
+		conns = append(conns, conn)
+		if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+			return fmt.Errorf("connection %d didn't answer: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// closeDatabase closes the connection pool of a database opened by openDatabase.
+// Closing waits for the queries still running, it is abandoned when ctx is done.
+//
+// Parameters:
+//   - ctx: The context bounding the wait
+//   - db: The database connection
+//
+// Returns:
+//   - An error if the pool couldn't be closed in time
+func closeDatabase(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return closeContext(ctx, sqlDB.Close)
+}
+
+// connectDatabases connects to the primary database and to the read replica when one is configured,
+// migrates the schema when DB_AUTO_MIGRATE is set, then reports SERVING. Either every step succeeds
+// or the opened connections are closed again, so it can be retried.
+//
+// Returns:
+//   - An error if a connection or the migration failed
+func (app *Application) connectDatabases() error {
+	cfg := app.config
+	primary, err := app.openDatabase("database", cfg.primaryEndpoint())
+	if err != nil {
+		return err
+	}
+	var replica *gorm.DB
+	if endpoint, ok := cfg.readEndpoint(); ok {
+		replica, err = app.openDatabase("read replica", endpoint)
+		if err != nil {
+			closeDatabase(context.Background(), primary)
+			return err
+		}
+	}
+	if err := app.migrateSchema(primary); err != nil {
+		closeDatabase(context.Background(), primary)
+		if replica != nil {
+			closeDatabase(context.Background(), replica)
+		}
+		return err
+	}
+	// A background reconnection finishing after stop would register connections and collectors nobody releases
+	if app.isStopped() {
+		closeDatabase(context.Background(), primary)
+		if replica != nil {
+			closeDatabase(context.Background(), replica)
+		}
+		return errApplicationStopped
+	}
+
+	app.addShutdown("database connection", func(ctx context.Context) error {
+		return closeDatabase(ctx, primary)
+	})
+	if replica != nil {
+		app.addShutdown("read replica connection", func(ctx context.Context) error {
+			return closeDatabase(ctx, replica)
+		})
+	}
+	app.dbMu.Lock()
+	app.tidbDatabase = primary
+	app.readDatabase = replica
+	app.dbMu.Unlock()
+	app.monitorPool("primary", primary)
+	if replica != nil {
+		app.monitorPool("replica", replica)
+	}
+
+	// Flip the health status to SERVING now that the database answers
+	app.setServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_SERVING)
+	if cfg.DBHealthcheckInterval > 0 {
+		app.watchDatabases(primary, replica)
+	}
+	return nil
+}
+
+// watchDatabases pings the connected databases in the background every DB_HEALTHCHECK_INTERVAL until the
+// application stops, so a database restarting at runtime doesn't need a restart of the server. On the first failed
+// ping the health status flips to NOT_SERVING, taking the instance out of the load balancing, and the idle
+// connections, invalidated by the restart, are dropped from the pools; the following pings open new connections,
+// and the status flips back to SERVING once they answer.
+//
+// Parameters:
+//   - primary: The primary database connection
+//   - replica: The read replica connection, nil without replica
+func (app *Application) watchDatabases(primary, replica *gorm.DB) {
+	interval := app.config.DBHealthcheckInterval
+	ctx, cancel := context.WithCancel(context.Background())
+	app.addShutdown("database health check", func(context.Context) error {
+		cancel()
+		return nil
+	})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		healthy := true
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := pingDatabases(ctx, primary, replica)
+			switch {
+			case err != nil && healthy:
+				healthy = false
+				log.Printf("Database health check failed, reporting NOT_SERVING and resetting the connection pools: %v", err)
+				app.setServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+				app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+				app.resetIdleConns(primary, replica)
+			case err != nil:
+				log.Printf("Database still unavailable, checking again in %s: %v", interval, err)
+				app.resetIdleConns(primary, replica)
+			case !healthy:
+				healthy = true
+				log.Println("Database recovered, reporting SERVING")
+				app.setServingStatus("", healthpb.HealthCheckResponse_SERVING)
+				app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_SERVING)
+			}
+		}
+	}()
+}
+
+// pingDatabases pings the primary database and the read replica, each within dbPingTimeout.
+//
+// Parameters:
+//   - ctx: The context canceled when the application stops
+//   - primary: The primary database connection
+//   - replica: The read replica connection, nil without replica
+//
+// Returns:
+//   - An error naming the database that didn't answer
+func pingDatabases(ctx context.Context, primary, replica *gorm.DB) error {
+	for _, db := range []struct {
+		name string
+		db   *gorm.DB
+	}{{"database", primary}, {"read replica", replica}} {
+		if db.db == nil {
+			continue
+		}
+		sqlDB, err := db.db.DB()
+		if err != nil {
+			return err
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+		err = sqlDB.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.name, err)
+		}
+	}
+	return nil
+}
+
+// resetIdleConns closes the idle connections of the pools, which a restarted database no longer knows: the handlers
+// would otherwise get them back and fail until they expire. The connections in use return to the pool, where a broken
+// one is discarded on its next use.
+//
+// Parameters:
+//   - dbs: The database connections, the nil ones are skipped
+func (app *Application) resetIdleConns(dbs ...*gorm.DB) {
+	for _, db := range dbs {
+		if db == nil {
+			continue
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			continue
+		}
+		// A pool keeping no idle connection closes the current ones, then the configured limit applies again
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(app.config.DBMaxIdleConns)
+	}
+}
+
+// migrateSchema creates or updates the table schema when DB_AUTO_MIGRATE is set,
+// production deployments can disable it with DB_AUTO_MIGRATE=false.
+//
+// Parameters:
+//   - db: The primary database connection
+//
+// Returns:
+//   - An error if the migration failed
+func (app *Application) migrateSchema(db *gorm.DB) error {
+	if !app.config.DBAutoMigrate {
+		return nil
+	}
+	// The tables of the tenants live in their own schemas, the default one isn't used
+	if app.config.MultiTenant {
+		return app.migrateTenantSchemas(db)
+	}
+	if err := db.AutoMigrate(app.schemaModels()...); err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+	log.Println("Database schema migrated")
+	return nil
+}
+
+// schemaModels returns the models whose tables migrateSchema creates, the audit_records table with AUDIT_DATABASE.
+//
+// Returns:
+//   - The models
+func (app *Application) schemaModels() []any {
+	models := []any{&TableRecord{}, &RecordAttribute{}}
+	if app.config.AuditDatabase {
+		models = append(models, &AuditRecord{})
+	}
+	return models
+}
+
+// reconnectDatabases keeps calling connectDatabases in the background every dbReconnectInterval until it succeeds
+// or the application stops. The server reports NOT_SERVING and the handlers return codes.Unavailable meanwhile.
+// The reconnection ends as soon as stop begins, and a connection opened while stop ran is closed right away.
+func (app *Application) reconnectDatabases() {
+	go func() {
+		ticker := time.NewTicker(dbReconnectInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-app.shutdownCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := app.connectDatabases()
+			if errors.Is(err, errApplicationStopped) {
+				return
+			}
+			if err != nil {
+				log.Printf("Database reconnection failed, retrying in %s: %v", dbReconnectInterval, err)
+				continue
+			}
+			log.Println("Database connected")
+			return
+		}
+	}()
+}
+
+// primaryDB returns the primary database connection, the one every write goes to.
+//
+// Returns:
+//   - The primary database connection, nil while it is not connected
+func (app *Application) primaryDB() *gorm.DB {
+	app.dbMu.RLock()
+	defer app.dbMu.RUnlock()
+	return app.tidbDatabase
+}
+
+// readDB returns the database connection for read-only queries,
+// the read replica when one is configured and the primary database otherwise.
+//
+// Returns:
+//   - The database connection to read from, nil while the databases are not connected
+func (app *Application) readDB() *gorm.DB {
+	app.dbMu.RLock()
+	defer app.dbMu.RUnlock()
+	if app.readDatabase != nil {
+		return app.readDatabase
+	}
+	return app.tidbDatabase
+}
+
+// databaseAvailable reports whether the databases are connected, handlers call it before their first query.
+//
+// Returns:
+//   - A codes.FailedPrecondition status error when DB_ENABLED=false, a codes.Unavailable one while the databases
+//     are not connected, nil otherwise
+func (app *Application) databaseAvailable() error {
+	if !app.config.DBEnabled && app.primaryDB() == nil {
+		return errDatabaseDisabled
+	}
+	if app.primaryDB() == nil {
+		return errDatabaseUnavailable
+	}
+	return nil
+}
+
+// inTransaction runs fn inside a database transaction bound to ctx.
+// The transaction is committed when fn returns nil and rolled back when it returns an error or panics.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - fn: The database work, which must use tx for every query
+//
+// Returns:
+//   - The error returned by fn, or the commit error
+func (app *Application) inTransaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	db := app.primaryDB()
+	if db == nil {
+		return errDatabaseUnavailable
+	}
+	return db.WithContext(ctx).Transaction(fn)
+}
+
+// Database error codes of transient failures that are safe to retry.
+const (
+	// mysqlErrLockWaitTimeout is the MySQL/TiDB error number for a lock wait timeout
+	mysqlErrLockWaitTimeout = 1205
+	// mysqlErrDeadlock is the MySQL/TiDB error number for a deadlock
+	mysqlErrDeadlock = 1213
+	// postgresErrDeadlock is the PostgreSQL SQLSTATE for a deadlock
+	postgresErrDeadlock = "40P01"
+	// postgresErrLockNotAvailable is the PostgreSQL SQLSTATE for a lock timeout
+	postgresErrLockNotAvailable = "55P03"
+)
+
+// isTransientDBError reports whether a database error is a deadlock or a lock timeout, which are worth retrying.
+// Duplicate keys, validation and any other errors are never considered transient.
+//
+// Parameters:
+//   - err: The error returned by the database
+//
+// Returns:
+//   - true if the operation can be retried
+func isTransientDBError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == postgresErrDeadlock || pgErr.Code == postgresErrLockNotAvailable
+	}
+	// Another process writing to the SQLite file locks it
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// withRetry runs a database operation through the circuit breaker, retrying transient failures with exponential
+// backoff. The operation is attempted at most DB_RETRY_MAX + 1 times, waiting DB_RETRY_BASE_DELAY before the first
+// retry and doubling the delay for every following one. Waiting stops early when ctx is done, and retrying stops
+// when the circuit breaker opens. An operation failing once ctx is done fails with the context error, whatever error
+// the driver returned for the interrupted query, so the handlers answer Canceled or DeadlineExceeded.
+//
+// Parameters:
+//   - ctx: The context bounding the retries
+//   - fn: The database operation
+//
+// Returns:
+//   - The error of the last attempt, errCircuitOpen if the breaker rejected it, or the context error wrapping the
+//     error of the attempt if ctx is done
+func (app *Application) withRetry(ctx context.Context, fn func() error) error {
+	delay := app.config.DBRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := app.dbBreaker.do(fn)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+		if err == nil || attempt >= app.config.DBRetryMax || !isTransientDBError(err) {
+			return err
+		}
+		loggerFromContext(ctx).Warn("transient database error, retrying",
+			"delay", delay, "attempt", attempt+1, "max_retries", app.config.DBRetryMax, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc/test/bufconn"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Latencies of the benchmarkDriver connections, the order of magnitude of a database in the same region.
+const (
+	// benchmarkHandshake is the time to open a connection: TCP, TLS and authentication
+	benchmarkHandshake = 2 * time.Millisecond
+	// benchmarkQuery is the time to run a query on an open connection, and to prepare a statement
+	benchmarkQuery = 200 * time.Microsecond
+	// benchmarkParse is the part of benchmarkQuery spent parsing and planning the query, which a prepared statement
+	// no longer pays
+	benchmarkParse = 50 * time.Microsecond
+)
+
+// benchmarkDriver is a database/sql driver whose connections take benchmarkHandshake to open, benchmarkQuery to
+// prepare or run a statement and benchmarkQuery-benchmarkParse to run a prepared one, counting the connections it
+// opened. The queries return no row.
+type benchmarkDriver struct {
+	// opened counts the connections opened
+	opened atomic.Int64
+}
+
+// Open opens a connection after the handshake delay.
+func (d *benchmarkDriver) Open(string) (driver.Conn, error) {
+	time.Sleep(benchmarkHandshake)
+	d.opened.Add(1)
+	return benchmarkConn{}, nil
+}
+
+// benchmarkConn is a connection of benchmarkDriver.
+type benchmarkConn struct{}
+
+// Prepare prepares a statement after the query delay.
+func (benchmarkConn) Prepare(string) (driver.Stmt, error) {
+	time.Sleep(benchmarkQuery)
+	return benchmarkStmt{}, nil
+}
+
+// Close closes the connection.
+func (benchmarkConn) Close() error {
+	return nil
+}
+
+// Begin isn't supported, the benchmark runs no transaction.
+func (benchmarkConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+// ExecContext runs a statement after the query delay.
+func (benchmarkConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	time.Sleep(benchmarkQuery)
+	return driver.RowsAffected(0), nil
+}
+
+// QueryContext runs a query after the query delay.
+func (benchmarkConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	time.Sleep(benchmarkQuery)
+	return benchmarkRows{}, nil
+}
+
+// benchmarkStmt is a statement prepared by a benchmarkConn, which runs without the parse delay.
+type benchmarkStmt struct{}
+
+// Close closes the statement.
+func (benchmarkStmt) Close() error {
+	return nil
+}
+
+// NumInput lets database/sql pass any number of arguments.
+func (benchmarkStmt) NumInput() int {
+	return -1
+}
+
+// Exec runs the statement after the query delay, less the parse delay.
+func (benchmarkStmt) Exec([]driver.Value) (driver.Result, error) {
+	time.Sleep(benchmarkQuery - benchmarkParse)
+	return driver.RowsAffected(0), nil
+}
+
+// Query runs the statement after the query delay, less the parse delay.
+func (benchmarkStmt) Query([]driver.Value) (driver.Rows, error) {
+	time.Sleep(benchmarkQuery - benchmarkParse)
+	return benchmarkRows{}, nil
+}
+
+// benchmarkRows is the empty result of a benchmarkDriver query.
+type benchmarkRows struct{}
+
+// Columns returns the columns of a record.
+func (benchmarkRows) Columns() []string {
+	return []string{"id", "a", "b"}
+}
+
+// Close closes the rows.
+func (benchmarkRows) Close() error {
+	return nil
+}
+
+// Next reports the end of the rows.
+func (benchmarkRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// benchmarkCallers is the number of concurrent callers of BenchmarkConnectionPool.
+const benchmarkCallers = 32
+
+// BenchmarkConnectionPool measures the queries of benchmarkCallers concurrent callers, each one pausing 1ms between
+// its queries so the number of connections in use keeps going up and down, for several values of DB_MAX_OPEN_CONNS
+// and DB_MAX_IDLE_CONNS. It reports the connections opened per query, each one paying a handshake, the queries that
+// waited for a free connection, and the mean and 99th percentile latency of the queries.
+func BenchmarkConnectionPool(b *testing.B) {
+	pools := []struct {
+		maxOpen int
+		maxIdle int
+	}{
+		{5, 5},
+		{10, 10},
+		{25, 0},
+		{25, 2},
+		{defaultDBMaxOpenConns, defaultDBMaxIdleConns},
+		{25, 10},
+		{25, 25},
+	}
+	for _, pool := range pools {
+		b.Run(fmt.Sprintf("max_open=%d/max_idle=%d", pool.maxOpen, pool.maxIdle), func(b *testing.B) {
+			d := &benchmarkDriver{}
+			db := sql.OpenDB(benchmarkConnector{d})
+			defer db.Close()
+			db.SetMaxOpenConns(pool.maxOpen)
+			db.SetMaxIdleConns(pool.maxIdle)
+			db.SetConnMaxLifetime(defaultDBConnMaxLifetime)
+			db.SetConnMaxIdleTime(defaultDBConnMaxIdleTime)
+
+			var next atomic.Int64
+			latencies := make([]time.Duration, b.N)
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for range benchmarkCallers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := next.Add(1) - 1; i < int64(b.N); i = next.Add(1) - 1 {
+						start := time.Now()
+						if _, err := db.ExecContext(context.Background(), "SELECT 1"); err != nil {
+							b.Error(err)
+							return
+						}
+						latencies[i] = time.Since(start)
+						time.Sleep(time.Millisecond)
+					}
+				}()
+			}
+			wg.Wait()
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			var total time.Duration
+			for _, latency := range latencies {
+				total += latency
+			}
+			b.ReportMetric(float64(d.opened.Load())/float64(b.N), "opens/op")
+			b.ReportMetric(float64(db.Stats().WaitCount)/float64(b.N), "waits/op")
+			b.ReportMetric(float64(total.Microseconds())/float64(b.N), "mean-µs")
+			b.ReportMetric(float64(latencies[b.N*99/100].Microseconds()), "p99-µs")
+		})
+	}
+}
+
+// benchmarkConnector opens the connections of a benchmarkDriver.
+type benchmarkConnector struct {
+	// driver is the driver opening the connections
+	driver *benchmarkDriver
+}
+
+// Connect opens a connection.
+func (c benchmarkConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+// Driver returns the driver.
+func (c benchmarkConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Load of BenchmarkFirstRequests.
+const (
+	// firstRequestCallers is the number of concurrent callers after the startup, the default DB_MAX_IDLE_CONNS
+	firstRequestCallers = defaultDBMaxIdleConns
+	// firstRequestsPerCaller is the number of requests of each caller
+	firstRequestsPerCaller = 4
+)
+
+// BenchmarkFirstRequests measures the first requests after a startup with DB_WARMUP_CONNS 0 and
+// firstRequestCallers, and DB_PREPARE_STMT off and on. Every iteration opens a new pool of benchmarkDriver
+// connections through GORM, pinged and warmed up as openDatabase does, then firstRequestCallers concurrent callers
+// read firstRequestsPerCaller records each. It reports the mean and 99th percentile latency of these reads.
+func BenchmarkFirstRequests(b *testing.B) {
+	for _, warmup := range []int{0, firstRequestCallers} {
+		for _, prepare := range []bool{false, true} {
+			b.Run(fmt.Sprintf("warmup_conns=%d/prepare_stmt=%t", warmup, prepare), func(b *testing.B) {
+				var latencies []time.Duration
+				var mu sync.Mutex
+				for range b.N {
+					b.StopTimer()
+					sqlDB := sql.OpenDB(benchmarkConnector{&benchmarkDriver{}})
+					sqlDB.SetMaxOpenConns(defaultDBMaxOpenConns)
+					sqlDB.SetMaxIdleConns(defaultDBMaxIdleConns)
+					db, err := gorm.Open(gormmysql.New(gormmysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+						&gorm.Config{Logger: gormlogger.Discard, PrepareStmt: prepare})
+					if err != nil {
+						b.Fatalf("gorm.Open: %v", err)
+					}
+					if warmup > 0 {
+						if err := warmupDatabase(context.Background(), sqlDB, warmup); err != nil {
+							b.Fatalf("warmupDatabase: %v", err)
+						}
+					}
+					b.StartTimer()
+
+					var wg sync.WaitGroup
+					for caller := range firstRequestCallers {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							for i := range firstRequestsPerCaller {
+								start := time.Now()
+								var record TableRecord
+								err := db.Where("a = ?", fmt.Sprintf("key%d-%d", caller, i)).Take(&record).Error
+								if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+									b.Error(err)
+									return
+								}
+								latency := time.Since(start)
+								mu.Lock()
+								latencies = append(latencies, latency)
+								mu.Unlock()
+							}
+						}()
+					}
+					wg.Wait()
+					b.StopTimer()
+					sqlDB.Close()
+				}
+
+				slices.Sort(latencies)
+				var total time.Duration
+				for _, latency := range latencies {
+					total += latency
+				}
+				b.ReportMetric(float64(total.Microseconds())/float64(len(latencies)), "mean-µs")
+				b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-µs")
+			})
+		}
+	}
+}
+
+// TestConnectDatabasesAfterStop checks that a database reconnection finishing once stop released the resources
+// closes its connections instead of registering them, and that a resource registered then is released right away.
+func TestConnectDatabasesAfterStop(t *testing.T) {
+	app, err := New(newTestConfig(t, sqliteTestEnv), WithListener(bufconn.Listen(testBufferSize)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := app.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	app.stop()
+	if app.shutdownCtx.Err() == nil {
+		t.Fatal("the shutdown context should be canceled once stopped, ending the background reconnection")
+	}
+
+	if err := app.connectDatabases(); !errors.Is(err, errApplicationStopped) {
+		t.Fatalf("connectDatabases after stop returned %v, want errApplicationStopped", err)
+	}
+	// The pool metrics of the primary database were unregistered by stop and not registered again
+	sqlDB, err := app.primaryDB().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := collectors.NewDBStatsCollector(sqlDB, "primary")
+	if err := prometheus.Register(collector); err != nil {
+		t.Fatalf("the primary pool metrics are still registered: %v", err)
+	}
+	prometheus.Unregister(collector)
+
+	released := false
+	app.addShutdown("late resource", func(context.Context) error {
+		released = true
+		return nil
+	})
+	if !released {
+		t.Fatal("a resource registered after stop should be released right away")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// dbPoolSampleInterval is the interval of the connection pool samples checked against DB_POOL_WAIT_WARN_THRESHOLD.
+const dbPoolSampleInterval = 10 * time.Second
+
+// monitorPool exposes the statistics of a connection pool as the go_sql_* Prometheus metrics labeled by db_name,
+// among them go_sql_wait_count_total and go_sql_wait_duration_seconds_total counting the queries that waited for a
+// free connection and how long, and samples them every dbPoolSampleInterval to log a warning when the average wait
+// of the interval exceeds DB_POOL_WAIT_WARN_THRESHOLD. The wait is the pool starvation part of the query latencies,
+// database/sql doesn't report it per query.
+//
+// Parameters:
+//   - dbName: The db_name label of the pool, "primary" or "replica"
+//   - db: The database connection
+func (app *Application) monitorPool(dbName string, db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+	collector := collectors.NewDBStatsCollector(sqlDB, dbName)
+	if err := prometheus.Register(collector); err != nil {
+		log.Printf("Failed to register the %s pool metrics: %v", dbName, err)
+	} else {
+		app.addShutdown(dbName+" pool metrics", func(context.Context) error {
+			prometheus.Unregister(collector)
+			return nil
+		})
+	}
+
+	threshold := app.config.DBPoolWaitWarnThreshold
+	if threshold <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	app.addShutdown(dbName+" pool monitor", func(context.Context) error {
+		cancel()
+		return nil
+	})
+	go func() {
+		ticker := time.NewTicker(dbPoolSampleInterval)
+		defer ticker.Stop()
+		previous := sqlDB.Stats()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			stats := sqlDB.Stats()
+			waits := stats.WaitCount - previous.WaitCount
+			if waits > 0 {
+				average := (stats.WaitDuration - previous.WaitDuration) / time.Duration(waits)
+				if average > threshold {
+					log.Printf("WARNING: %d queries waited %s on average for a %s database connection in the last %s, the pool is starved: in_use=%d max_open_conns=%d",
+						waits, average, dbName, dbPoolSampleInterval, stats.InUse, stats.MaxOpenConnections)
+				}
+			}
+			previous = stats
+		}
+	}()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envLoader reads typed values from environment variables and collects every parsing error,
+// so all invalid settings are reported at once instead of one per restart.
+type envLoader struct {
+	// errs holds the errors of the variables that failed to parse
+	errs []error
+}
+
+// string reads a string environment variable.
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The variable value
+func (l *envLoader) string(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// secret reads a secret string environment variable, from the file named by the <name>_FILE variable when it is
+// set, e.g. a Docker or Kubernetes secret mount, so the secret doesn't show in the process environment. The file
+// takes precedence over the inline variable, and the trailing newlines of its contents are trimmed.
+//
+// Parameters:
+//   - name: The environment variable name, <name>_FILE naming the secret file
+//   - defaultValue: The value returned when neither variable is set
+//
+// Returns:
+//   - The secret value, an error is recorded when the file can't be read
+func (l *envLoader) secret(name string, defaultValue string) string {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return l.string(name, defaultValue)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("failed to read %s_FILE: %w", name, err))
+		return defaultValue
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// required reads a string environment variable that must be set.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The variable value, an error is recorded when it is unset or empty
+func (l *envLoader) required(name string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		l.errs = append(l.errs, fmt.Errorf("%s is required", name))
+	}
+	return value
+}
+
+// list reads a comma-separated environment variable, trimming the spaces around every item and dropping empty ones.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The list items, nil when the variable is unset or empty
+func (l *envLoader) list(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// prefixes reads a comma-separated list of IP addresses and CIDR ranges (e.g. "10.0.0.0/8,192.168.1.10"), an
+// address being a range of its own.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The ranges, nil when the variable is unset or empty
+func (l *envLoader) prefixes(name string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range l.list(name) {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s items must be IP addresses or CIDR ranges such as 10.0.0.0/8, got %q", name, item))
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// bool reads a boolean environment variable.
+// Accepted values are the ones understood by strconv.ParseBool (1, t, true, 0, f, false, ...).
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The parsed boolean value
+func (l *envLoader) bool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a boolean, got %q", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// boolsWithPrefix reads every boolean environment variable whose name starts with prefix, e.g. FEATURE_.
+//
+// Parameters:
+//   - prefix: The variable name prefix
+//
+// Returns:
+//   - The parsed values keyed by variable name without the prefix, nil when no such variable is set
+func (l *envLoader) boolsWithPrefix(prefix string) map[string]bool {
+	var values map[string]bool
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		key, ok := strings.CutPrefix(name, prefix)
+		if !ok || key == "" {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]bool)
+		}
+		values[key] = l.bool(name, false)
+	}
+	return values
+}
+
+// int reads a non-negative integer environment variable.
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The parsed integer value
+func (l *envLoader) int(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative integer, got %q", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// fileMode reads an optional octal file mode environment variable, such as 0660.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The parsed file mode, 0 when the variable is unset or empty
+func (l *envLoader) fileMode(name string) os.FileMode {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || parsed > uint64(os.ModePerm) {
+		l.errs = append(l.errs, fmt.Errorf("%s must be an octal file mode such as 0660, got %q", name, value))
+		return 0
+	}
+	return os.FileMode(parsed)
+}
+
+// positiveInt reads an optional strictly positive integer environment variable.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The parsed integer value, 0 when the variable is unset or empty
+func (l *envLoader) positiveInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a positive integer, got %q", name, value))
+		return 0
+	}
+	return parsed
+}
+
+// positiveUint32 reads an optional strictly positive integer environment variable fitting in a uint32.
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The parsed integer value, 0 when the variable is unset or empty
+func (l *envLoader) positiveUint32(name string) uint32 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || parsed == 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a positive integer up to %d, got %q", name, uint32(math.MaxUint32), value))
+		return 0
+	}
+	return uint32(parsed)
+}
+
+// float reads a non-negative floating point environment variable.
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The parsed floating point value
+func (l *envLoader) float(name string, defaultValue float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative number, got %q", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// duration reads a non-negative Go duration environment variable (e.g. "30s", "5m").
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The parsed duration
+func (l *envLoader) duration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a non-negative duration such as 30s, got %q", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// durationMap reads a comma-separated list of name=duration pairs (e.g. "/pkg.Service/Method=2s").
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The durations keyed by name, nil when the variable is unset or empty
+func (l *envLoader) durationMap(name string) map[string]time.Duration {
+	var durations map[string]time.Duration
+	for _, item := range l.list(name) {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || key == "" || err != nil || parsed < 0 {
+			l.errs = append(l.errs, fmt.Errorf("%s items must be name=duration such as /pkg.Service/Method=2s, got %q", name, item))
+			continue
+		}
+		if durations == nil {
+			durations = make(map[string]time.Duration)
+		}
+		durations[key] = parsed
+	}
+	return durations
+}
+
+// stringMap reads a comma-separated list of name=value pairs (e.g. "acme=acme_db,globex=globex_db").
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The values keyed by name, nil when the variable is unset or empty
+func (l *envLoader) stringMap(name string) map[string]string {
+	var values map[string]string
+	for _, item := range l.list(name) {
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			l.errs = append(l.errs, fmt.Errorf("%s items must be name=value such as acme=acme_db, got %q", name, item))
+			continue
+		}
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// fieldsMap reads a comma-separated list of name=fields pairs, the fields being separated by spaces
+// (e.g. "/pkg.Service/Method=scope1 scope2").
+//
+// Parameters:
+//   - name: The environment variable name
+//
+// Returns:
+//   - The fields keyed by name, nil when the variable is unset or empty
+func (l *envLoader) fieldsMap(name string) map[string][]string {
+	var fields map[string][]string
+	for key, value := range l.stringMap(name) {
+		if fields == nil {
+			fields = make(map[string][]string)
+		}
+		fields[key] = strings.Fields(value)
+	}
+	return fields
+}
+
+// location reads a time zone environment variable, an IANA name such as "Europe/Paris", "UTC" or "Local".
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The loaded time zone
+func (l *envLoader) location(name string, defaultValue *time.Location) *time.Location {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be an IANA time zone such as UTC or Europe/Paris, got %q: %w", name, value, err))
+		return defaultValue
+	}
+	return loc
+}
+
+// level reads a log level environment variable, one of debug, info, warn or error.
+//
+// Parameters:
+//   - name: The environment variable name
+//   - defaultValue: The value returned when the variable is unset or empty
+//
+// Returns:
+//   - The parsed log level
+func (l *envLoader) level(name string, defaultValue slog.Level) slog.Level {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(value)); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s must be debug, info, warn or error, got %q", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// err returns the collected errors joined together, or nil if every variable parsed.
+func (l *envLoader) err() error {
+	return errors.Join(l.errs...)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"gorm.io/gorm"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to the errors of the handlers.
+const errorDomain = "myservice"
+
+// Reasons of the ErrorInfo details, stable machine-readable codes the clients can switch on.
+const (
+	// reasonInvalidArgument is a request field failing the validation, the field is in the "field" metadata
+	reasonInvalidArgument = "INVALID_ARGUMENT"
+	// reasonNotFound is a record missing from the database
+	reasonNotFound = "RECORD_NOT_FOUND"
+	// reasonDuplicateKey is a record whose key is already used
+	reasonDuplicateKey = "DUPLICATE_KEY"
+	// reasonDatabaseUnavailable is a database not connected yet
+	reasonDatabaseUnavailable = "DB_UNAVAILABLE"
+	// reasonDatabaseDisabled is a method needing the database called with DB_ENABLED=false
+	reasonDatabaseDisabled = "DB_DISABLED"
+	// reasonDatabaseOverloaded is a database operation rejected by the open circuit breaker
+	reasonDatabaseOverloaded = "DB_OVERLOADED"
+	// reasonShuttingDown is a stream ended by the shutdown of the server
+	reasonShuttingDown = "SERVER_SHUTTING_DOWN"
+	// reasonMissingScope is a caller lacking a scope required by the method, the scopes are in the "scopes" metadata
+	reasonMissingScope = "MISSING_SCOPE"
+	// reasonTenantRequired is a request without the tenant-id header with MULTITENANT
+	reasonTenantRequired = "TENANT_REQUIRED"
+	// reasonUnknownTenant is a request for a tenant missing from TENANT_SCHEMAS, the tenant is in the "tenant" metadata
+	reasonUnknownTenant = "UNKNOWN_TENANT"
+	// reasonDeadlineExceeded is a request whose deadline expired
+	reasonDeadlineExceeded = "DEADLINE_EXCEEDED"
+	// reasonCanceled is a request canceled by the client
+	reasonCanceled = "CANCELED"
+	// reasonInternal is an unexpected failure, its details are only logged
+	reasonInternal = "INTERNAL"
+	// reasonAuditUnavailable is a mutating request rejected because its audit event can't be written
+	reasonAuditUnavailable = "AUDIT_UNAVAILABLE"
+	// reasonIdempotencyUnavailable is a request with an idempotency key rejected because the store can't be read
+	reasonIdempotencyUnavailable = "IDEMPOTENCY_UNAVAILABLE"
+	// reasonIdempotencyKeyReused is an idempotency key already used for a different request
+	reasonIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// Database error codes of duplicate primary or unique keys.
+const (
+	// mysqlErrDuplicateEntry is the MySQL/TiDB error number for a duplicate primary or unique key
+	mysqlErrDuplicateEntry = 1062
+	// postgresErrUniqueViolation is the PostgreSQL SQLSTATE for a duplicate primary or unique key
+	postgresErrUniqueViolation = "23505"
+)
+
+// toGRPCError converts an error returned to a handler, usually by the database, into a gRPC status error.
+// It is the single error mapping layer of the handlers:
+//   - a status error, such as errDatabaseUnavailable, is returned as is
+//   - gorm.ErrRecordNotFound becomes codes.NotFound, with the RECORD_NOT_FOUND reason
+//   - context.DeadlineExceeded and context.Canceled become codes.DeadlineExceeded and codes.Canceled
+//   - a duplicate key becomes codes.AlreadyExists, with the DUPLICATE_KEY reason
+//   - every other failure is logged and becomes codes.Internal, without exposing its details to the client
+//
+// Every converted error carries an ErrorInfo detail built by errorWithInfo.
+//
+// Parameters:
+//   - err: The error to convert
+//
+// Returns:
+//   - The gRPC status error, or nil if err is nil
+func toGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errorWithInfo(codes.NotFound, reasonNotFound, "record not found", nil)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorWithInfo(codes.DeadlineExceeded, reasonDeadlineExceeded, "deadline exceeded", nil)
+	}
+	if errors.Is(err, context.Canceled) {
+		return errorWithInfo(codes.Canceled, reasonCanceled, "request canceled", nil)
+	}
+	if isDuplicateKeyError(err) {
+		return errorWithInfo(codes.AlreadyExists, reasonDuplicateKey, "record already exists", nil)
+	}
+	log.Printf("internal error: %v", err)
+	return errorWithInfo(codes.Internal, reasonInternal, "internal error", nil)
+}
+
+// recordNotFoundError builds the codes.NotFound error of a record method finding no record with the requested key,
+// naming the key in the message and in the "a" metadata.
+//
+// Parameters:
+//   - a: The requested record key
+//
+// Returns:
+//   - The NotFound status error
+func recordNotFoundError(a string) error {
+	return errorWithInfo(codes.NotFound, reasonNotFound, fmt.Sprintf("record %q not found", a), map[string]string{"a": a})
+}
+
+// errorWithInfo builds a gRPC status error carrying an ErrorInfo detail, so the clients can tell the failures apart
+// from its reason instead of parsing the message. The handlers build their errors with it, directly or through
+// toGRPCError, so every error has the same details. A client reads them back with status.Convert(err).Details().
+//
+// Parameters:
+//   - code: The gRPC status code
+//   - reason: The machine-readable reason, one of the reason constants
+//   - message: The human-readable message
+//   - metadata: The context of the failure, e.g. the invalid field or the record key, nil for none
+//
+// Returns:
+//   - The status error, without details if they can't be attached
+func errorWithInfo(code codes.Code, reason string, message string, metadata map[string]string) error {
+	st := status.New(code, message)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain, Metadata: metadata})
+	if err != nil {
+		log.Printf("failed to attach the error details of %s: %v", reason, err)
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// withErrorMetadata adds an entry to the ErrorInfo metadata of a status error, e.g. the key of the record a handler
+// failed on, once toGRPCError converted it. Errors without ErrorInfo are returned as is.
+//
+// Parameters:
+//   - err: The status error
+//   - key: The metadata key
+//   - value: The metadata value
+//
+// Returns:
+//   - The status error with the added metadata
+func withErrorMetadata(err error, key string, value string) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	// Proto returns a copy, the errors built once like errDatabaseUnavailable are shared
+	pb := st.Proto()
+	for i, detail := range pb.GetDetails() {
+		var info errdetails.ErrorInfo
+		if !detail.MessageIs(&info) || detail.UnmarshalTo(&info) != nil {
+			continue
+		}
+		if info.Metadata == nil {
+			info.Metadata = make(map[string]string)
+		}
+		info.Metadata[key] = value
+		updated, err := anypb.New(&info)
+		if err != nil {
+			continue
+		}
+		pb.Details[i] = updated
+	}
+	return status.FromProto(pb).Err()
+}
+
+// isDuplicateKeyError reports whether a database error is a duplicate primary or unique key.
+//
+// Parameters:
+//   - err: The database error
+//
+// Returns:
+//   - true if err is a MySQL/TiDB, PostgreSQL or SQLite duplicate key error
+func isDuplicateKeyError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pgErr *pgconn.PgError
+	var sqliteErr sqlite3.Error
+	return (errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry) ||
+		(errors.As(err, &pgErr) && pgErr.Code == postgresErrUniqueViolation) ||
+		(errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorInfo decodes the ErrorInfo detail of an error received by a client, failing the test if it has none.
+//
+// Parameters:
+//   - t: The test
+//   - err: The error returned by the call
+//
+// Returns:
+//   - The ErrorInfo detail
+func errorInfo(t testing.TB, err error) *errdetails.ErrorInfo {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("%v is not a status error", err)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("%v has no ErrorInfo detail, got %v", err, st.Details())
+	return nil
+}
+
+// TestErrorDetails checks the ErrorInfo details a client decodes from the errors of the handlers: their code, reason,
+// domain and metadata.
+func TestErrorDetails(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, sqliteTestEnv))
+	client := myservice.NewMyServiceClient(conn)
+	_, disabledConn := startTestServer(t, newTestConfig(t, nil))
+	disabledClient := myservice.NewMyServiceClient(disabledConn)
+	ctx := context.Background()
+	if _, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key", B: 1}); err != nil {
+		t.Fatalf("MyMethod: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		call     func() error
+		code     codes.Code
+		reason   string
+		metadata map[string]string
+	}{
+		{
+			name: "invalid argument",
+			call: func() error {
+				_, err := client.MyMethod(ctx, &myservice.MyRequest{})
+				return err
+			},
+			code:     codes.InvalidArgument,
+			reason:   reasonInvalidArgument,
+			metadata: map[string]string{"field": "a"},
+		},
+		{
+			name: "duplicate key",
+			call: func() error {
+				_, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key", B: 2})
+				return err
+			},
+			code:     codes.AlreadyExists,
+			reason:   reasonDuplicateKey,
+			metadata: map[string]string{"a": "key"},
+		},
+		{
+			name: "not found",
+			call: func() error {
+				_, err := client.GetRecord(ctx, &myservice.GetRecordRequest{A: "missing"})
+				return err
+			},
+			code:     codes.NotFound,
+			reason:   reasonNotFound,
+			metadata: map[string]string{"a": "missing"},
+		},
+		{
+			name: "failing record of a transactional batch",
+			call: func() error {
+				_, err := client.CreateRecords(ctx, &myservice.CreateRecordsRequest{Transactional: true, Records: []*myservice.MyRequest{
+					{A: "key1", B: 1},
+					{A: "", B: 2},
+				}})
+				return err
+			},
+			code:     codes.InvalidArgument,
+			reason:   reasonInvalidArgument,
+			metadata: map[string]string{"field": "a", "index": "1"},
+		},
+		{
+			name: "database disabled",
+			call: func() error {
+				_, err := disabledClient.MyMethod(ctx, &myservice.MyRequest{A: "key", B: 1})
+				return err
+			},
+			code:   codes.FailedPrecondition,
+			reason: reasonDatabaseDisabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("the call returned %v, want %v", err, tt.code)
+			}
+			info := errorInfo(t, err)
+			if info.GetReason() != tt.reason || info.GetDomain() != errorDomain {
+				t.Fatalf("reason %q in domain %q, want %q in %q", info.GetReason(), info.GetDomain(), tt.reason, errorDomain)
+			}
+			if !maps.Equal(info.GetMetadata(), tt.metadata) {
+				t.Fatalf("metadata %v, want %v", info.GetMetadata(), tt.metadata)
+			}
+		})
+	}
+}
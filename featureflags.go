@@ -0,0 +1,61 @@
+package main
+
+import "strings"
+
+// featureFlagPrefix is the prefix of the environment variables turning a feature flag on or off,
+// e.g. FEATURE_NEW_WRITE_PATH=true.
+const featureFlagPrefix = "FEATURE_"
+
+// featureFlagKey normalizes a feature flag name, so FEATURE_NEW_WRITE_PATH is looked up as "newWritePath",
+// "new_write_path" or "NEW_WRITE_PATH" alike: lower case, without the underscores and dashes.
+//
+// Parameters:
+//   - name: The flag name
+//
+// Returns:
+//   - The normalized name
+func featureFlagKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// newFeatureFlags keys the flags read from the FEATURE_* variables by featureFlagKey.
+//
+// Parameters:
+//   - values: The flag values keyed by variable name without the prefix
+//
+// Returns:
+//   - The flags keyed by normalized name, nil when none is set
+func newFeatureFlags(values map[string]bool) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	flags := make(map[string]bool, len(values))
+	for name, on := range values {
+		flags[featureFlagKey(name)] = on
+	}
+	return flags
+}
+
+// Feature reports whether a feature flag is on, so the handlers can branch on the experimental behaviors turned on
+// per environment with the FEATURE_* variables. Safe for concurrent use, a reload replacing the flags.
+//
+// Parameters:
+//   - name: The flag name, e.g. "newWritePath" for FEATURE_NEW_WRITE_PATH
+//
+// Returns:
+//   - true if the flag is set to a true value, false when it is off or unset
+func (app *Application) Feature(name string) bool {
+	flags := app.featureFlags.Load()
+	if flags == nil {
+		return false
+	}
+	return (*flags)[featureFlagKey(name)]
+}
+
+// setFeatureFlags replaces the flags read by Feature.
+//
+// Parameters:
+//   - flags: The flags keyed by featureFlagKey, never modified afterwards
+func (app *Application) setFeatureFlags(flags map[string]bool) {
+	app.featureFlags.Store(&flags)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// gatewayBufferSize is the buffer size of the in-memory connection between the gateway and the gRPC server.
+const gatewayBufferSize = 1024 * 1024
+
+// gatewayClientIPKey is the metadata key the gateway forwards the address of the HTTP client under. The gRPC
+// server only trusts it on the connections of the gateway, see peerIP.
+const gatewayClientIPKey = "x-gateway-client-ip"
+
+// gatewayHeaders are the HTTP headers forwarded to the gRPC server as metadata under their own name,
+// on top of Authorization and the Grpc-Metadata- prefixed ones forwarded by default.
+var gatewayHeaders = map[string]bool{
+	textproto.CanonicalMIMEHeaderKey(requestIDHeader):      true,
+	textproto.CanonicalMIMEHeaderKey(idempotencyKeyHeader): true,
+	textproto.CanonicalMIMEHeaderKey(tenantIDHeader):       true,
+}
+
+// setupGateway serves the REST/JSON gateway of MyService on HTTP_GATEWAY_PORT. The gateway calls the gRPC server
+// through an in-memory listener, so every request goes through the same interceptors as a gRPC client, and the gRPC
+// status of a failed call is translated to the HTTP status, e.g. NotFound to 404 and InvalidArgument to 400.
+// The gateway server is shut down by stop, with the other HTTP servers.
+//
+// Returns:
+//   - An error if the gateway port can't be listened on or the gateway can't be registered
+func (app *Application) setupGateway() error {
+	cfg := app.config
+	lis := bufconn.Listen(gatewayBufferSize)
+	// Served by start like the other gRPC listeners, and closed by stop. Its connections are told apart from the
+	// other clients by their gatewayAddr
+	app.netListeners = append(app.netListeners, gatewayListener{Listener: lis})
+
+	// The connection never leaves the process, there is no server certificate to verify
+	creds := insecure.NewCredentials()
+	if cfg.TLSCertFile != "" {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+	}
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(creds),
+	)
+	if err != nil {
+		return err
+	}
+	app.addCloser("gateway client connection", conn)
+
+	gateway := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		// Every call reaches the server from the in-memory connection, pass on the address of the HTTP client for
+		// the rate limiting, the logs and the audit
+		runtime.WithMetadata(func(_ context.Context, r *http.Request) metadata.MD {
+			return metadata.Pairs(gatewayClientIPKey, httpClientIP(r, cfg.GatewayTrustedProxies))
+		}),
+	)
+	if err := myservice.RegisterMyServiceHandler(context.Background(), gateway, conn); err != nil {
+		return err
+	}
+	mux, err := app.httpMux("gateway server", ":"+strconv.Itoa(cfg.HTTPGatewayPort))
+	if err != nil {
+		return err
+	}
+	// Every path not claimed by the metrics and probes when they share the port
+	mux.Handle("/", gateway)
+	return nil
+}
+
+// gatewayHeaderMatcher selects the HTTP headers forwarded to the gRPC server as metadata, the gatewayHeaders
+// under their own name and the others like runtime.DefaultHeaderMatcher, except a Grpc-Metadata- header that would
+// set the client address of gatewayClientIPKey.
+//
+// Parameters:
+//   - key: The canonical HTTP header name
+//
+// Returns:
+//   - The metadata key
+//   - true if the header is forwarded
+func gatewayHeaderMatcher(key string) (string, bool) {
+	if gatewayHeaders[key] {
+		return key, true
+	}
+	name, ok := runtime.DefaultHeaderMatcher(key)
+	if strings.EqualFold(name, gatewayClientIPKey) {
+		return "", false
+	}
+	return name, ok
+}
+
+// httpClientIP returns the address of the HTTP client of a gateway request. It is the address of the connection,
+// unless the connection comes from a trusted proxy: it is then the last X-Forwarded-For address not belonging to a
+// trusted proxy, every proxy appending the address it received the request from.
+//
+// Parameters:
+//   - r: The HTTP request
+//   - trusted: The trusted proxies (GATEWAY_TRUSTED_PROXIES)
+//
+// Returns:
+//   - The client IP address
+func httpClientIP(r *http.Request, trusted []netip.Prefix) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && trustedProxy(client, trusted); i-- {
+		// The addresses left of a malformed one were written by the client itself
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+	}
+	return client
+}
+
+// trustedProxy reports whether an address belongs to a trusted proxy.
+//
+// Parameters:
+//   - ip: The IP address
+//   - trusted: The trusted proxies
+//
+// Returns:
+//   - true if ip is in one of the trusted ranges
+func trustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trusted {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayListener is the in-memory listener the gateway connects to, its connections reporting a gatewayAddr as
+// their remote address so the server recognizes them.
+type gatewayListener struct {
+	*bufconn.Listener
+}
+
+// Accept waits for the next gateway connection.
+func (l gatewayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return gatewayConn{Conn: conn}, nil
+}
+
+// gatewayConn is a connection of the gateway to the gRPC server.
+type gatewayConn struct {
+	net.Conn
+}
+
+// RemoteAddr returns the gatewayAddr.
+func (gatewayConn) RemoteAddr() net.Addr {
+	return gatewayAddr{}
+}
+
+// gatewayAddr is the peer address of the calls made by the gateway, whose gatewayClientIPKey metadata holds the
+// address of the HTTP client.
+type gatewayAddr struct{}
+
+// Network returns the network of the in-memory connection.
+func (gatewayAddr) Network() string {
+	return "bufconn"
+}
+
+// String returns the name of the gateway.
+func (gatewayAddr) String() string {
+	return "gateway"
+}
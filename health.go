@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// myServiceName is the fully qualified name of MyService used as the key for its health status.
+var myServiceName = myservice.MyService_ServiceDesc.ServiceName
+
+// setServingStatus updates the health status reported by the gRPC health service.
+// Use an empty service name for the overall server status, or a fully qualified service name
+// (e.g. myServiceName) to mark a single service as degraded.
+//
+// Parameters:
+//   - service: The fully qualified service name, or "" for the whole server
+//   - servingStatus: The new serving status
+func (app *Application) setServingStatus(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	if app.healthServer == nil {
+		return
+	}
+	log.Printf("Health status of %q set to %s", service, servingStatus)
+	app.healthServer.SetServingStatus(service, servingStatus)
+}
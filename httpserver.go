@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// readinessTimeout bounds the database ping performed by the /readyz endpoint.
+const readinessTimeout = 2 * time.Second
+
+// httpServer is an auxiliary HTTP server (metrics, probes) running next to the gRPC server.
+type httpServer struct {
+	// server is the HTTP server
+	server *http.Server
+	// listener is the network listener of the server
+	listener net.Listener
+	// mux routes the requests to the handlers registered on the server
+	mux *http.ServeMux
+}
+
+// httpMux returns the request multiplexer of the HTTP server listening on addr.
+// The server is created and registered for shutdown on first use, so features configured
+// with the same address share one server.
+//
+// Parameters:
+//   - name: The server name used in the logs when it is created
+//   - addr: The address to listen on, e.g. ":9090"
+//
+// Returns:
+//   - The request multiplexer to register handlers on
+//   - An error if the server can't listen on addr
+func (app *Application) httpMux(name string, addr string) (*http.ServeMux, error) {
+	if existing, ok := app.httpServers[addr]; ok {
+		return existing.mux, nil
+	}
+	var listener net.Listener
+	err := retryListen(app.config, addr, func() (err error) {
+		listener, err = net.Listen("tcp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the %s on %s: %w", name, addr, err)
+	}
+	mux := http.NewServeMux()
+	server := &http.Server{Handler: mux}
+	if app.httpServers == nil {
+		app.httpServers = make(map[string]*httpServer)
+	}
+	app.httpServers[addr] = &httpServer{server: server, listener: listener, mux: mux}
+	app.addShutdown(name, server.Shutdown)
+	return mux, nil
+}
+
+// startHTTPServers serves every auxiliary HTTP server in the background, reporting a failure on errCh.
+func (app *Application) startHTTPServers() {
+	for _, s := range app.httpServers {
+		go func() {
+			log.Printf("HTTP server listening on %s", s.listener.Addr())
+			if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				app.errCh <- fmt.Errorf("HTTP server on %s failed: %w", s.listener.Addr(), err)
+			}
+		}()
+	}
+}
+
+// registerPprof registers the net/http/pprof handlers under /debug/pprof/ on mux, instead of on the default mux
+// the pprof package registers them on.
+//
+// Parameters:
+//   - mux: The request multiplexer of the pprof server
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// handleHealthz answers the liveness probe, the process is alive as long as it answers.
+func (app *Application) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz answers the readiness probe, the server is ready only when the database answers a ping,
+// or always when DB_ENABLED=false.
+func (app *Application) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !app.config.DBEnabled && app.primaryDB() == nil {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ready")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	err := errDatabaseUnavailable
+	if db := app.primaryDB(); db != nil {
+		var sqlDB *sql.DB
+		sqlDB, err = db.DB()
+		if err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+	}
+	if err != nil {
+		log.Printf("readiness check failed: %v", err)
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ready")
+}
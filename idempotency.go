@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// idempotencyKeyHeader is the metadata header carrying the idempotency key of a request
+	idempotencyKeyHeader = "idempotency-key"
+	// idempotencyReplayedHeader is the response header set when the response is replayed from the store
+	idempotencyReplayedHeader = "idempotency-replayed"
+	// maxIdempotencyKeyLength is the maximum length of an idempotency key
+	maxIdempotencyKeyLength = 255
+	// idempotencySweepInterval is how often the expired entries of the in-memory store are evicted
+	idempotencySweepInterval = time.Minute
+)
+
+// idempotencyEvictionsTotal counts the responses evicted from the full in-memory idempotency store before they expired.
+var idempotencyEvictionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "idempotency_store_evictions_total",
+	Help: "Total number of idempotency responses evicted from the full in-memory store before they expired.",
+})
+
+func init() {
+	prometheus.MustRegister(idempotencyEvictionsTotal)
+}
+
+// idempotentMethods are the full method names deduplicated with the idempotency-key header.
+var idempotentMethods = map[string]bool{
+	myservice.MyService_MyMethod_FullMethodName:      true,
+	myservice.MyService_CreateRecords_FullMethodName: true,
+}
+
+// IdempotencyStore stores the responses of the requests carrying an idempotency key, so a retried request
+// gets the original response. The in-memory default only deduplicates the retries reaching the same
+// instance, share a store, e.g. backed by Redis or a database table, between the replicas of a service.
+type IdempotencyStore interface {
+	// Get returns the value stored for key, false if there is none or it expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value for key, replacing the previous one, until ttl elapsed
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// idempotencyRecord is the value stored for an idempotency key.
+type idempotencyRecord struct {
+	// RequestHash is the SHA-256 of the request, telling a retry apart from a reused key
+	RequestHash []byte `json:"request_hash"`
+	// Response is the response as a marshaled anypb.Any
+	Response []byte `json:"response"`
+}
+
+// memoryIdempotencyStore is an IdempotencyStore keeping the entries in memory, evicting them once expired. It holds
+// at most maxEntries entries, the least recently used one being evicted to make room for a new one, so a client
+// sending a new key with every call can't grow it for the whole TTL.
+type memoryIdempotencyStore struct {
+	// mu protects the fields below
+	mu sync.Mutex
+	// maxEntries is the maximum number of stored entries
+	maxEntries int
+	// entries holds the list element of every stored key
+	entries map[string]*list.Element
+	// order holds the memoryIdempotencyEntry values, the most recently used first
+	order *list.List
+	// lastSweep is the last time the expired entries were evicted
+	lastSweep time.Time
+}
+
+// memoryIdempotencyEntry is a value of the in-memory store with its expiration time.
+type memoryIdempotencyEntry struct {
+	// key is the idempotency key
+	key string
+	// value is the stored value
+	value []byte
+	// expiresAt is the time after which the entry is ignored and evicted
+	expiresAt time.Time
+}
+
+// newMemoryIdempotencyStore creates an empty in-memory idempotency store.
+//
+// Parameters:
+//   - maxEntries: The maximum number of stored entries (IDEMPOTENCY_MAX_ENTRIES)
+//
+// Returns:
+//   - The in-memory store
+func newMemoryIdempotencyStore(maxEntries int) *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		lastSweep:  time.Now(),
+	}
+}
+
+// Get returns the value stored for key, false if there is none or it expired.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - key: The idempotency key
+//
+// Returns:
+//   - The stored value
+//   - true if a value that didn't expire was found
+//   - Always nil, the in-memory store can't fail
+func (s *memoryIdempotencyStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryIdempotencyEntry)
+	if time.Now().After(entry.expiresAt) {
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set stores value for key until ttl elapsed, evicting the expired entries from time to time, and the least recently
+// used ones when the store is full.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - key: The idempotency key
+//   - value: The value to store
+//   - ttl: How long the value is kept
+//
+// Returns:
+//   - Always nil, the in-memory store can't fail
+func (s *memoryIdempotencyStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > idempotencySweepInterval {
+		for k, element := range s.entries {
+			if now.After(element.Value.(*memoryIdempotencyEntry).expiresAt) {
+				s.order.Remove(element)
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryIdempotencyEntry)
+		entry.value, entry.expiresAt = value, now.Add(ttl)
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&memoryIdempotencyEntry{key: key, value: value, expiresAt: now.Add(ttl)})
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryIdempotencyEntry).key)
+		idempotencyEvictionsTotal.Inc()
+	}
+	return nil
+}
+
+// keyedMutex serializes the holders of the same key while letting different keys run concurrently.
+type keyedMutex struct {
+	// mu protects locks
+	mu sync.Mutex
+	// locks holds the lock of every key currently held or waited for
+	locks map[string]*keyLock
+}
+
+// keyLock is the lock of a single key with the number of goroutines holding or waiting for it.
+type keyLock struct {
+	// mu is the lock of the key
+	mu sync.Mutex
+	// refs is the number of goroutines holding or waiting for mu, the lock is removed at zero
+	refs int
+}
+
+// lock acquires the lock of key, blocking while another goroutine holds it.
+//
+// Parameters:
+//   - key: The key to lock
+//
+// Returns:
+//   - The function releasing the lock
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// idempotencyUnaryInterceptor builds an interceptor deduplicating the requests carrying an idempotency-key header.
+// The first successful response of a key is stored for ttl and returned to the following requests with that key,
+// with the idempotency-replayed header, instead of calling the handler again. Concurrent requests with the same key
+// wait for the first one. A failed request isn't stored so it can be retried, and a key reused with a different
+// request is rejected with codes.FailedPrecondition. Requests without the header, or to other methods, are passed
+// through.
+//
+// Parameters:
+//   - store: The store of the responses
+//   - ttl: How long a response is replayed
+//   - methods: The full method names to deduplicate
+//
+// Returns:
+//   - The idempotency interceptor
+func idempotencyUnaryInterceptor(store IdempotencyStore, ttl time.Duration, methods map[string]bool) grpc.UnaryServerInterceptor {
+	var inFlight keyedMutex
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !methods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		values := metadata.ValueFromIncomingContext(ctx, idempotencyKeyHeader)
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+		key := values[0]
+		if key == "" || len(key) > maxIdempotencyKeyLength {
+			return nil, errorWithInfo(codes.InvalidArgument, reasonInvalidArgument,
+				fmt.Sprintf("%s must be 1 to %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength),
+				map[string]string{"field": idempotencyKeyHeader})
+		}
+		requestHash, err := hashRequest(req)
+		if err != nil {
+			return nil, toGRPCError(err)
+		}
+
+		// Scope the key to the method so two methods can't replay each other's responses, and to the tenant
+		// so a tenant can't replay the responses of another one
+		storeKey := info.FullMethod + ":" + key
+		if t, ok := tenantFromContext(ctx); ok {
+			storeKey = t.id + ":" + storeKey
+		}
+		unlock := inFlight.lock(storeKey)
+		defer unlock()
+
+		stored, found, err := store.Get(ctx, storeKey)
+		if err != nil {
+			log.Printf("Idempotency store lookup of %s failed: %v", key, err)
+			return nil, errorWithInfo(codes.Unavailable, reasonIdempotencyUnavailable, "idempotency store unavailable", nil)
+		}
+		if found {
+			return replayResponse(ctx, stored, requestHash)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := storeResponse(ctx, store, storeKey, requestHash, resp, ttl); err != nil {
+			// The request succeeded, a retry would only be executed again
+			log.Printf("Failed to store the response of idempotency key %s: %v", key, err)
+		}
+		return resp, nil
+	}
+}
+
+// hashRequest returns the SHA-256 of the deterministic encoding of a request.
+//
+// Parameters:
+//   - req: The request message
+//
+// Returns:
+//   - The request hash
+//   - An error if the request isn't a protobuf message or can't be marshaled
+func hashRequest(req any) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("request %T is not a protobuf message", req)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// storeResponse stores the response of a request under its idempotency key.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - store: The store of the responses
+//   - key: The scoped idempotency key
+//   - requestHash: The hash of the request
+//   - resp: The response to store
+//   - ttl: How long the response is replayed
+//
+// Returns:
+//   - An error if the response can't be encoded or stored
+func storeResponse(ctx context.Context, store IdempotencyStore, key string, requestHash []byte, resp any, ttl time.Duration) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return fmt.Errorf("response %T is not a protobuf message", resp)
+	}
+	response, err := anypb.New(msg)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(response)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(idempotencyRecord{RequestHash: requestHash, Response: data})
+	if err != nil {
+		return err
+	}
+	return store.Set(ctx, key, value, ttl)
+}
+
+// replayResponse decodes a stored response and marks it as replayed with the idempotency-replayed header.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - stored: The value stored for the idempotency key
+//   - requestHash: The hash of the current request
+//
+// Returns:
+//   - The original response
+//   - codes.FailedPrecondition if the key was used for a different request, codes.Internal if the value is corrupt
+func replayResponse(ctx context.Context, stored []byte, requestHash []byte) (any, error) {
+	var record idempotencyRecord
+	if err := json.Unmarshal(stored, &record); err != nil {
+		return nil, toGRPCError(fmt.Errorf("failed to decode stored response: %w", err))
+	}
+	if !bytes.Equal(record.RequestHash, requestHash) {
+		return nil, errorWithInfo(codes.FailedPrecondition, reasonIdempotencyKeyReused,
+			fmt.Sprintf("%s was already used for a different request", idempotencyKeyHeader), nil)
+	}
+	var response anypb.Any
+	if err := proto.Unmarshal(record.Response, &response); err != nil {
+		return nil, toGRPCError(fmt.Errorf("failed to decode stored response: %w", err))
+	}
+	resp, err := response.UnmarshalNew()
+	if err != nil {
+		return nil, toGRPCError(fmt.Errorf("failed to decode stored response: %w", err))
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(idempotencyReplayedHeader, "true"))
+	return resp, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unaryInterceptors returns the unary interceptors of the server in chain order, the first one being the outermost:
+//   - request ID, so every following log line carries it
+//   - version, setting the x-server-version trailer of every RPC, the rejected ones included
+//   - recovery, turning a panic anywhere below into codes.Internal
+//   - logging and metrics, recording every RPC reaching them, including the rejected ones
+//   - payload logging, when LOG_PAYLOADS is set, debug only
+//   - timeout, when SERVER_METHOD_TIMEOUT or SERVER_METHOD_TIMEOUTS is set, bounding everything below
+//   - auth, when API_TOKEN is set
+//   - authorization, when METHOD_SCOPES is set, checking the scopes of the principal stored by auth
+//   - tenant, when MULTITENANT is set, after auth so an unauthenticated client can't probe the tenants
+//   - rate limit
+//   - idempotency, when IDEMPOTENCY_TTL is set, after auth and rate limit so a replay counts as a request
+//   - audit, when an audit sink is configured, after idempotency so a replay executing nothing isn't audited
+//   - compression, when GRPC_COMPRESSION is set
+//   - the interceptors added with WithUnaryInterceptors
+//
+// Insert an interceptor of your own at the position it needs here, or add it innermost with WithUnaryInterceptors.
+//
+// Returns:
+//   - The ordered unary interceptors
+func (app *Application) unaryInterceptors() []grpc.UnaryServerInterceptor {
+	cfg := app.config
+	interceptors := []grpc.UnaryServerInterceptor{
+		requestIDUnaryInterceptor,
+		versionUnaryInterceptor,
+		recoveryUnaryInterceptor,
+		loggingUnaryInterceptor,
+		metricsUnaryInterceptor,
+	}
+	// Log the messages of every RPC while debugging
+	if cfg.LogPayloads {
+		interceptors = append(interceptors, newPayloadLogger(cfg.LogPayloadRedactFields, cfg.LogPayloadMaxBytes).unaryInterceptor)
+	}
+	// Cap the duration of the RPCs whatever the client deadline
+	if cfg.ServerMethodTimeout > 0 || len(cfg.ServerMethodTimeouts) > 0 {
+		interceptors = append(interceptors, timeoutUnaryInterceptor(cfg.ServerMethodTimeout, cfg.ServerMethodTimeouts))
+	}
+	// Require a bearer token on every RPC, except the skipped methods, when an API token is configured
+	if cfg.APIToken != "" {
+		interceptors = append(interceptors, authUnaryInterceptor(cfg.APIToken, cfg.apiTokenPrincipal(), cfg.AuthSkipMethods))
+	}
+	// Restrict the methods listed in METHOD_SCOPES to the callers holding their scopes
+	if len(cfg.MethodScopes) > 0 {
+		interceptors = append(interceptors, authzUnaryInterceptor(cfg.MethodScopes))
+	}
+	// Select the schema of the tenant of every RPC
+	if cfg.MultiTenant {
+		interceptors = append(interceptors, tenantUnaryInterceptor(cfg.TenantSchemas))
+	}
+	interceptors = append(interceptors, rateLimitUnaryInterceptor(app.rateLimiter))
+	// Replay the stored response of a repeated idempotency key instead of executing the request again
+	if cfg.IdempotencyTTL > 0 {
+		interceptors = append(interceptors, idempotencyUnaryInterceptor(app.idempotencyStore, cfg.IdempotencyTTL, idempotentMethods))
+	}
+	// Write the attempt and the result of every mutating RPC to the audit log
+	if app.auditSink != nil {
+		interceptors = append(interceptors, auditUnaryInterceptor(app.auditSink))
+	}
+	// Compress the responses above the threshold for the clients supporting it when a compression is configured
+	if cfg.GRPCCompression != "" {
+		interceptors = append(interceptors, compressionUnaryInterceptor(cfg.GRPCCompression, cfg.GRPCCompressionMinSize))
+	}
+	return append(interceptors, app.extraUnaryInterceptors...)
+}
+
+// streamInterceptors returns the stream interceptors of the server in chain order, the first one being the outermost,
+// following the order of unaryInterceptors for the interceptors having a stream version.
+//
+// Returns:
+//   - The ordered stream interceptors
+func (app *Application) streamInterceptors() []grpc.StreamServerInterceptor {
+	cfg := app.config
+	interceptors := []grpc.StreamServerInterceptor{
+		requestIDStreamInterceptor,
+		versionStreamInterceptor,
+		recoveryStreamInterceptor,
+		loggingStreamInterceptor,
+		inFlightStreamInterceptor,
+		messageSizeStreamInterceptor,
+	}
+	if cfg.LogPayloads {
+		interceptors = append(interceptors, newPayloadLogger(cfg.LogPayloadRedactFields, cfg.LogPayloadMaxBytes).streamInterceptor)
+	}
+	// Cap the duration of the streams too, a client can't hold one open past the timeout of its method
+	if cfg.ServerMethodTimeout > 0 || len(cfg.ServerMethodTimeouts) > 0 {
+		interceptors = append(interceptors, timeoutStreamInterceptor(cfg.ServerMethodTimeout, cfg.ServerMethodTimeouts))
+	}
+	if cfg.APIToken != "" {
+		interceptors = append(interceptors, authStreamInterceptor(cfg.APIToken, cfg.apiTokenPrincipal(), cfg.AuthSkipMethods))
+	}
+	if len(cfg.MethodScopes) > 0 {
+		interceptors = append(interceptors, authzStreamInterceptor(cfg.MethodScopes))
+	}
+	if cfg.MultiTenant {
+		interceptors = append(interceptors, tenantStreamInterceptor(cfg.TenantSchemas))
+	}
+	// Opening a stream consumes a token of the client like a unary RPC
+	interceptors = append(interceptors, rateLimitStreamInterceptor(app.rateLimiter))
+	if cfg.GRPCCompression != "" {
+		interceptors = append(interceptors, compressionStreamInterceptor(cfg.GRPCCompression))
+	}
+	return append(interceptors, app.extraStreamInterceptors...)
+}
+
+// contextServerStream is a server stream whose context was replaced by an interceptor,
+// e.g. to carry the request ID to the handler.
+type contextServerStream struct {
+	grpc.ServerStream
+	// ctx is the context returned to the handler
+	ctx context.Context
+}
+
+// Context returns the replaced context of the stream.
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// loggingUnaryInterceptor logs the full method name, the gRPC status code and the elapsed duration of every unary RPC,
+// the client IP address, and the common name of the client certificate with mutual TLS.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logger := loggerFromContext(ctx)
+	// The address of the HTTP client for the REST calls, see peerIP
+	if ip := peerIP(ctx); ip != "" {
+		logger = logger.With("client_ip", ip)
+	}
+	// Identify the calling service with mutual TLS
+	if cn := clientCommonName(ctx); cn != "" {
+		logger = logger.With("client_cn", cn)
+	}
+	logger.Info("rpc completed", "method", info.FullMethod, "status", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+// loggingStreamInterceptor logs the opening of every stream, then its closing with the final gRPC status code and
+// the elapsed duration, the client IP address, and the common name of the client certificate with mutual TLS.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - An error if the handler failed
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := ss.Context()
+	logger := loggerFromContext(ctx)
+	if ip := peerIP(ctx); ip != "" {
+		logger = logger.With("client_ip", ip)
+	}
+	if cn := clientCommonName(ctx); cn != "" {
+		logger = logger.With("client_cn", cn)
+	}
+	start := time.Now()
+	logger.Info("stream opened", "method", info.FullMethod)
+	err := handler(srv, ss)
+	logger.Info("stream closed", "method", info.FullMethod, "status", status.Code(err).String(), "duration", time.Since(start))
+	return err
+}
+
+// recoveryUnaryInterceptor recovers a panic raised by the handler, logs it with its stack trace,
+// and returns codes.Internal to the client instead of crashing the process.
+// Chain it outermost, after the request ID only, so it also recovers the panics of the other interceptors.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed or panicked
+func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			loggerFromContext(ctx).Error("panic recovered", "method", info.FullMethod, "panic", r, "stack", string(debug.Stack()))
+			resp, err = nil, status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoveryStreamInterceptor is the streaming counterpart of recoveryUnaryInterceptor,
+// ending the stream with codes.Internal when the handler panics.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - An error if the handler failed or panicked
+func recoveryStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			loggerFromContext(ss.Context()).Error("panic recovered", "method", info.FullMethod, "panic", r, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(srv, ss)
+}
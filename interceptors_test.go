@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// panickingService is a MyService whose record methods panic.
+type panickingService struct {
+	myservice.UnimplementedMyServiceServer
+}
+
+// MyMethod panics.
+func (panickingService) MyMethod(context.Context, *myservice.MyRequest) (*myservice.MyResponse, error) {
+	panic("bad record")
+}
+
+// StreamRecords panics.
+func (panickingService) StreamRecords(*myservice.StreamRecordsRequest, grpc.ServerStreamingServer[myservice.Record]) error {
+	panic("bad stream")
+}
+
+// TestRecoveryInterceptors checks that a panicking handler answers Internal, its panic recovered by the recovery
+// interceptors, while the server keeps serving the following calls.
+func TestRecoveryInterceptors(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, nil), WithRegisterServices(func(server *grpc.Server, app *Application) {
+		myservice.RegisterMyServiceServer(server, panickingService{})
+	}))
+	client := myservice.NewMyServiceClient(conn)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key"})
+		if code := status.Code(err); code != codes.Internal {
+			t.Fatalf("call %d: MyMethod returned %v, want Internal", i, err)
+		}
+	}
+
+	stream, err := client.StreamRecords(ctx, &myservice.StreamRecordsRequest{})
+	if err != nil {
+		t.Fatalf("StreamRecords: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Internal {
+		t.Fatalf("StreamRecords returned %v, want Internal", err)
+	}
+
+	// The process survived the panics and still serves
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("health check after the panics: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("health status %s after the panics, want SERVING", resp.GetStatus())
+	}
+}
+
+// payloadRecorder is a client stats handler recording the size of the last response message received, as sent on
+// the wire and once decompressed.
+type payloadRecorder struct {
+	// mu protects the fields below
+	mu sync.Mutex
+	// wireLength is the size of the message on the wire
+	wireLength int
+	// length is the size of the decompressed message
+	length int
+}
+
+// TagRPC returns ctx unchanged.
+func (r *payloadRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC records the sizes of the received messages.
+func (r *payloadRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InPayload); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.wireLength, r.length = in.CompressedLength, in.Length
+	}
+}
+
+// TagConn returns ctx unchanged.
+func (r *payloadRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn ignores the connection events.
+func (r *payloadRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+// compressed tells whether the last response received was compressed, its wire size differing from its size.
+func (r *payloadRecorder) compressed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.wireLength != r.length
+}
+
+// startRecordedServer starts a test server configured with env and connects to it a client recording the size of
+// the responses it receives.
+//
+// Parameters:
+//   - t: The test
+//   - env: The environment variables of the server configuration
+//
+// Returns:
+//   - The recorder of the responses received
+//   - The client connection, closed with the server at the end of the test
+func startRecordedServer(t *testing.T, env map[string]string) (*payloadRecorder, *grpc.ClientConn) {
+	t.Helper()
+	lis := bufconn.Listen(testBufferSize)
+	app, err := New(newTestConfig(t, env), WithListener(lis))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := app.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(app.stop)
+	recorder := &payloadRecorder{}
+	return recorder, dialTestServer(t, lis, grpc.WithStatsHandler(recorder))
+}
+
+// TestResponseCompression checks that GRPC_COMPRESSION=gzip compresses the responses of GRPC_COMPRESSION_MIN_SIZE
+// bytes or more for the clients supporting gzip, without them compressing their requests, and that the responses
+// aren't compressed without it.
+func TestResponseCompression(t *testing.T) {
+	// The GetVersion response of the test server
+	size := proto.Size(&myservice.GetVersionResponse{Version: version, Commit: commit, BuildDate: buildDate})
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"at the threshold", map[string]string{"GRPC_COMPRESSION": "gzip", "GRPC_COMPRESSION_MIN_SIZE": strconv.Itoa(size)}, true},
+		{"below the threshold", map[string]string{"GRPC_COMPRESSION": "gzip", "GRPC_COMPRESSION_MIN_SIZE": strconv.Itoa(size + 1)}, false},
+		{"disabled", map[string]string{"GRPC_COMPRESSION_MIN_SIZE": "0"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, conn := startRecordedServer(t, tt.env)
+			if _, err := myservice.NewMyServiceClient(conn).GetVersion(context.Background(), &myservice.GetVersionRequest{}); err != nil {
+				t.Fatalf("GetVersion: %v", err)
+			}
+			if recorder.compressed() != tt.want {
+				t.Fatalf("response compressed: %t, want %t", recorder.compressed(), tt.want)
+			}
+		})
+	}
+}
+
+// TestStreamCompression checks that GRPC_COMPRESSION=gzip compresses the messages of a stream whatever their size and
+// GRPC_COMPRESSION_MIN_SIZE, and that they aren't compressed without it.
+func TestStreamCompression(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"gzip", map[string]string{"GRPC_COMPRESSION": "gzip", "GRPC_COMPRESSION_MIN_SIZE": "1048576"}, true},
+		{"disabled", map[string]string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := maps.Clone(sqliteTestEnv)
+			maps.Copy(env, tt.env)
+			recorder, conn := startRecordedServer(t, env)
+			client := myservice.NewMyServiceClient(conn)
+			ctx := context.Background()
+			if _, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key1", B: 1}); err != nil {
+				t.Fatalf("MyMethod: %v", err)
+			}
+
+			stream, err := client.StreamRecords(ctx, &myservice.StreamRecordsRequest{})
+			if err != nil {
+				t.Fatalf("StreamRecords: %v", err)
+			}
+			if _, err := stream.Recv(); err != nil {
+				t.Fatalf("receiving the record: %v", err)
+			}
+			if recorder.compressed() != tt.want {
+				t.Fatalf("streamed record compressed: %t, want %t", recorder.compressed(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"google.golang.org/grpc/codes"
+)
+
+// errServerShuttingDown is returned by the stream handlers ending their stream because the server shuts down.
+var errServerShuttingDown = errorWithInfo(codes.Unavailable, reasonShuttingDown, "server shutting down, retry on another instance", nil)
+
+// streamsStopping returns a channel closed once the shutdown asks the long-lived stream handlers to return, after
+// the drain timed out. A handler streaming until the client goes away should return errServerShuttingDown when it
+// is closed, so its stream ends with a status before the connection is closed.
+//
+// Returns:
+//   - The channel closed when the streams should end
+func (app *Application) streamsStopping() <-chan struct{} {
+	return app.stopStreams
+}
+
+// runStartHooks runs the OnStart hooks in registration order, stopping at the first failure.
+//
+// Parameters:
+//   - ctx: The context shared by every hook
+//
+// Returns:
+//   - The error of the first failing hook, nil if every hook succeeded
+func (app *Application) runStartHooks(ctx context.Context) error {
+	for i, hook := range app.OnStart {
+		if err := hook(ctx); err != nil {
+			return fmt.Errorf("start hook %d failed: %w", i, err)
+		}
+	}
+	if len(app.OnStart) > 0 {
+		log.Printf("%d start hooks completed", len(app.OnStart))
+	}
+	return nil
+}
+
+// runFlushHooks runs the OnFlush hooks in registration order.
+// A failing hook is logged and doesn't prevent the following ones from running, nor the shutdown.
+// Once ctx is done the remaining hooks are skipped.
+//
+// Parameters:
+//   - ctx: The context shared by every hook, done after SHUTDOWN_FLUSH_TIMEOUT
+func (app *Application) runFlushHooks(ctx context.Context) {
+	for i, hook := range app.OnFlush {
+		if ctx.Err() != nil {
+			log.Printf("Skipping flush hook %d: %v", i, ctx.Err())
+			continue
+		}
+		if err := hook(ctx); err != nil {
+			log.Printf("Flush hook %d failed: %v", i, err)
+		}
+	}
+	log.Printf("%d flush hooks completed", len(app.OnFlush))
+}
+
+// runStopHooks runs the OnStop hooks in registration order.
+// A failing hook is logged and doesn't prevent the following ones from running, nor the shutdown.
+// Once ctx is done the remaining hooks are skipped, a slow hook should return when it sees ctx done.
+//
+// Parameters:
+//   - ctx: The context shared by every hook, done after SHUTDOWN_HOOKS_TIMEOUT
+func (app *Application) runStopHooks(ctx context.Context) {
+	for i, hook := range app.OnStop {
+		if ctx.Err() != nil {
+			log.Printf("Skipping stop hook %d: %v", i, ctx.Err())
+			continue
+		}
+		if err := hook(ctx); err != nil {
+			log.Printf("Stop hook %d failed: %v", i, err)
+		}
+	}
+	if len(app.OnStop) > 0 {
+		log.Printf("%d stop hooks completed", len(app.OnStop))
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// unixSocketProbeTimeout bounds the dial telling a stale unix socket file apart from one a running server accepts on.
+const unixSocketProbeTimeout = time.Second
+
+// listenGRPC opens the listeners of the gRPC server on the configured address. On Linux, GRPC_LISTENERS tcp
+// listeners share the port with SO_REUSEPORT so the connections are accepted by several goroutines; elsewhere,
+// and for unix sockets, a single listener is opened. The stale file of a unix socket is removed first, and the
+// socket is given the GRPC_UNIX_SOCKET_MODE mode.
+//
+// Parameters:
+//   - cfg: The configuration
+//
+// Returns:
+//   - The listeners, at least one
+//   - An error if a listener couldn't be opened, the ones already opened are closed then
+func listenGRPC(cfg *Config) ([]net.Listener, error) {
+	network, address := cfg.listenAddress()
+	count := cfg.GRPCListeners
+	if count > 1 && (network != "tcp" || !reusePortSupported) {
+		log.Printf("GRPC_LISTENERS=%d requires SO_REUSEPORT on a tcp address, opening a single listener", count)
+		count = 1
+	}
+	if count <= 1 {
+		if network == "unix" {
+			if err := removeStaleUnixSocket(address); err != nil {
+				return nil, err
+			}
+		}
+		var lis net.Listener
+		err := retryListen(cfg, address, func() (err error) {
+			lis, err = net.Listen(network, address)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s %s: %w", network, address, err)
+		}
+		if network == "unix" && cfg.GRPCUnixSocketMode != 0 && !isAbstractUnixSocket(address) {
+			if err := os.Chmod(address, cfg.GRPCUnixSocketMode); err != nil {
+				lis.Close()
+				return nil, fmt.Errorf("failed to set the mode of unix socket %s: %w", address, err)
+			}
+		}
+		return []net.Listener{lis}, nil
+	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		var lis net.Listener
+		err := retryListen(cfg, address, func() (err error) {
+			lis, err = lc.Listen(context.Background(), network, address)
+			return err
+		})
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("failed to listen on %s %s with SO_REUSEPORT: %w", network, address, err)
+		}
+		// Bind the following listeners to the port picked by the system for port 0
+		address = lis.Addr().String()
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// retryListen calls listen until it succeeds, retrying up to LISTEN_RETRY_ATTEMPTS times while the address is
+// already in use, e.g. by the previous process of a fast restart still releasing the port. The delay between two
+// attempts starts at LISTEN_RETRY_DELAY and doubles after every retry. Other errors are returned at once.
+//
+// Parameters:
+//   - cfg: The configuration
+//   - address: The address listened on, used in the logs
+//   - listen: The function opening the listener
+//
+// Returns:
+//   - The error of the last attempt, nil once listen succeeded
+func retryListen(cfg *Config, address string, listen func() error) error {
+	delay := cfg.ListenRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := listen()
+		if err == nil || attempt > cfg.ListenRetryAttempts || !errors.Is(err, syscall.EADDRINUSE) {
+			return err
+		}
+		log.Printf("Address %s already in use, retrying in %s (%d/%d)", address, delay, attempt, cfg.ListenRetryAttempts)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// removeStaleUnixSocket removes the socket file left at path by a process that exited without unlinking it, e.g.
+// after a crash, which would make the listen fail. A socket a running server still accepts on is kept, the listen
+// then fails with "address already in use" and is retried like a tcp one. A path holding anything else than a
+// socket is an error rather than being deleted.
+//
+// Parameters:
+//   - path: The path of the unix socket
+//
+// Returns:
+//   - An error if the path isn't a socket or the stale socket can't be removed
+func removeStaleUnixSocket(path string) error {
+	if isAbstractUnixSocket(path) {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check unix socket %s: %w", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix socket path %s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, unixSocketProbeTimeout); err == nil {
+		conn.Close()
+		return nil
+	}
+	log.Printf("Removing stale unix socket %s", path)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// removeUnixSocket unlinks the unix socket file at path during the shutdown. Closing the listener usually removed
+// it already, a missing file is not an error.
+//
+// Parameters:
+//   - path: The path of the unix socket
+//
+// Returns:
+//   - An error if the file can't be removed
+func removeUnixSocket(path string) error {
+	if isAbstractUnixSocket(path) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// isAbstractUnixSocket reports whether path names a Linux abstract socket, such as @my-server, which has no file.
+//
+// Parameters:
+//   - path: The path of the unix socket
+//
+// Returns:
+//   - true for an abstract socket
+func isAbstractUnixSocket(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// closeListeners closes every listener, ignoring the ones already closed.
+//
+// Parameters:
+//   - listeners: The listeners to close
+//
+// Returns:
+//   - The errors of the listeners that failed to close, nil if none
+func closeListeners(listeners []net.Listener) error {
+	var errs []error
+	for _, lis := range listeners {
+		if err := lis.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
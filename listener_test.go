@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkAccept measures the rate of new connections the server accepts with 1 and several GRPC_LISTENERS, the
+// clients dialing and closing connections in parallel on the loopback interface. Each listener runs its own accept
+// loop, as the gRPC server does, and the kernel spreads the connections between them. The accept loops only gain
+// from spare cores, run it with -cpu to compare the core counts.
+func BenchmarkAccept(b *testing.B) {
+	for _, listeners := range []int{1, 4} {
+		b.Run(fmt.Sprintf("listeners=%d", listeners), func(b *testing.B) {
+			if listeners > 1 && !reusePortSupported {
+				b.Skip("SO_REUSEPORT is not supported on this platform")
+			}
+			cfg := newTestConfig(b, map[string]string{
+				"GRPC_LISTEN_ADDR": "127.0.0.1:0",
+				"GRPC_LISTENERS":   strconv.Itoa(listeners),
+			})
+			lis, err := listenGRPC(cfg)
+			if err != nil {
+				b.Fatalf("listenGRPC: %v", err)
+			}
+			b.Cleanup(func() { closeListeners(lis) })
+			for _, l := range lis {
+				go func() {
+					for {
+						conn, err := l.Accept()
+						if errors.Is(err, net.ErrClosed) {
+							return
+						}
+						if err == nil {
+							conn.Close()
+						}
+					}
+				}()
+			}
+			address := lis[0].Addr().String()
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					conn, err := net.Dial("tcp", address)
+					if err != nil {
+						b.Errorf("dialing %s: %v", address, err)
+						return
+					}
+					// Reset the connection on close rather than leaving it in TIME_WAIT, which would exhaust the
+					// local ports of a long run
+					conn.(*net.TCPConn).SetLinger(0)
+					conn.Close()
+				}
+			})
+		})
+	}
+}
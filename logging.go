@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// gormLogLevels are the accepted GORM_LOG_LEVEL values.
+var gormLogLevels = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+// newLogger builds the structured logger for the given LOG_FORMAT.
+// The "text" format returns nil, meaning the standard log package output is kept as is.
+// The "json" format writes one JSON object per line with the level, ts and msg fields plus the record attributes.
+//
+// Parameters:
+//   - format: The log format, "text" or "json"
+//   - w: The writer receiving the log lines
+//   - level: The minimum level of the JSON records, it can be changed while the logger is in use
+//   - loc: The time zone of the ts field
+//
+// Returns:
+//   - The JSON logger, or nil for the text format
+//   - An error if the format is not supported
+func newLogger(format string, w io.Writer, level slog.Leveler, loc *time.Location) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return nil, nil
+	case "json":
+		handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				// Our log pipeline expects the timestamp in the ts field
+				if len(groups) == 0 && attr.Key == slog.TimeKey {
+					attr.Key = "ts"
+					attr.Value = slog.TimeValue(attr.Value.Time().In(loc))
+				}
+				return attr
+			},
+		})
+		return slog.New(handler), nil
+	default:
+		return nil, fmt.Errorf("unsupported LOG_FORMAT %q, expected text or json", format)
+	}
+}
+
+// openLogFile creates LOG_DIR when needed and opens the log file of the day, dated in loc. The file is rolled over
+// to a timestamped backup when it exceeds LOG_MAX_SIZE_MB.
+//
+// Parameters:
+//   - cfg: The configuration
+//   - loc: The time zone of the date in the file name
+//
+// Returns:
+//   - The opened log file
+//   - An error if the directory can't be created or the file can't be opened
+func openLogFile(cfg *Config, loc *time.Location) (*lumberjack.Logger, error) {
+	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	timestamp := time.Now().In(loc).Format("2006-01-02")
+	logFile := &lumberjack.Logger{
+		Filename:   filepath.Join(cfg.LogDir, fmt.Sprintf("my-server-%s.log", timestamp)),
+		MaxSize:    cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAge:     cfg.LogMaxAgeDays,
+	}
+	// Open the file right away so an unwritable log directory is detected now rather than on the first line
+	if _, err := logFile.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return logFile, nil
+}
+
+// timestampWriter prefixes every line written by the log package with its timestamp in a given time zone,
+// formatted like the log.Ldate, log.Ltime and log.Lmicroseconds flags, which only know the local time and UTC.
+// The log package writes each line with a single Write call, serialized by the logger.
+type timestampWriter struct {
+	// w receives the timestamped lines
+	w io.Writer
+	// loc is the time zone of the timestamps
+	loc *time.Location
+}
+
+// Write writes the line p prefixed with the current time.
+//
+// Parameters:
+//   - p: The log line
+//
+// Returns:
+//   - The number of bytes of p written
+//   - An error if the underlying writer failed
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	line := time.Now().In(t.loc).AppendFormat(make([]byte, 0, 27+len(p)), "2006/01/02 15:04:05.000000 ")
+	if _, err := t.w.Write(append(line, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setLogLevel changes the minimum level of the structured log records while the server runs.
+// The text format goes through the default slog handler, whose level is set with slog.SetLogLoggerLevel.
+// Lines written with the log package directly are not filtered.
+//
+// Parameters:
+//   - level: The new minimum level
+func (app *Application) setLogLevel(level slog.Level) {
+	app.logLevel.Set(level)
+	if app.config.LogFormat == "text" {
+		slog.SetLogLoggerLevel(level)
+	}
+}
+
+// toggleDebugLogLevel switches the log level between debug and the configured LOG_LEVEL, to get the debug records
+// during an incident without restarting.
+//
+// Parameters:
+//   - cause: What triggered the change, e.g. the signal name, logged with it
+func (app *Application) toggleDebugLogLevel(cause string) {
+	level := slog.LevelDebug
+	if app.logLevel.Level() == slog.LevelDebug {
+		level = app.config.LogLevel
+	}
+	app.changeLogLevel(level, cause)
+}
+
+// resetLogLevel sets the log level back to the configured LOG_LEVEL, undoing toggleDebugLogLevel.
+//
+// Parameters:
+//   - cause: What triggered the change, e.g. the signal name, logged with it
+func (app *Application) resetLogLevel(cause string) {
+	app.changeLogLevel(app.config.LogLevel, cause)
+}
+
+// changeLogLevel sets the log level and logs the change with the log package, so the line is written whatever the
+// new level and the change can be audited.
+//
+// Parameters:
+//   - level: The new minimum level
+//   - cause: What triggered the change
+func (app *Application) changeLogLevel(level slog.Level, cause string) {
+	previous := app.logLevel.Level()
+	app.setLogLevel(level)
+	log.Printf("Log level changed from %s to %s by %s, configured level %s", previous, level, cause, app.config.LogLevel)
+}
+
+// newGormLogger builds the GORM logger writing through the log package, so the query logs end up in the log file
+// like the other lines. Queries slower than slowThreshold are logged as warnings, and missing records answered
+// with NotFound are not logged as errors.
+//
+// Parameters:
+//   - level: The GORM_LOG_LEVEL value, silent, error, warn or info
+//   - slowThreshold: The duration above which a query is logged as slow, 0 disables the slow query log
+//
+// Returns:
+//   - The GORM logger
+func newGormLogger(level string, slowThreshold time.Duration) gormlogger.Interface {
+	return gormlogger.New(log.Default(), gormlogger.Config{
+		SlowThreshold:             slowThreshold,
+		LogLevel:                  gormLogLevels[level],
+		IgnoreRecordNotFoundError: true,
+		Colorful:                  false,
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// logLevelSignals is empty where SIGUSR1 and SIGUSR2 don't exist, the log level is changed with a reload instead.
+var logLevelSignals []os.Signal
+
+// handleLogLevelSignal handles no signal where SIGUSR1 and SIGUSR2 don't exist.
+//
+// Parameters:
+//   - sig: The received signal
+//
+// Returns:
+//   - Always false
+func (app *Application) handleLogLevelSignal(sig os.Signal) bool {
+	return false
+}
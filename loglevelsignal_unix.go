@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// logLevelSignals are the signals changing the log level while the server runs, see handleLogLevelSignal.
+var logLevelSignals = []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2}
+
+// handleLogLevelSignal toggles the log level between the configured one and debug on SIGUSR1, and resets it to the
+// configured one on SIGUSR2.
+//
+// Parameters:
+//   - sig: The received signal
+//
+// Returns:
+//   - true if the signal was a log level signal
+func (app *Application) handleLogLevelSignal(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGUSR1:
+		app.toggleDebugLogLevel("SIGUSR1")
+	case syscall.SIGUSR2:
+		app.resetLogLevel("SIGUSR2")
+	default:
+		return false
+	}
+	return true
+}
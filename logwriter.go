@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// asyncLogBufferSize is the size of the buffer of the asynchronous log writer
+	asyncLogBufferSize = 64 * 1024
+	// asyncLogFlushInterval is how often the asynchronous log writer flushes its buffer
+	asyncLogFlushInterval = time.Second
+)
+
+// asyncWriter buffers the writes to an underlying writer and flushes them in the background,
+// so logging a line doesn't cost a write system call. The lines written since the last flush are lost on a crash.
+type asyncWriter struct {
+	// mu protects buf
+	mu sync.Mutex
+	// buf buffers the writes to w
+	buf *bufio.Writer
+	// w is the underlying writer
+	w io.WriteCloser
+	// done stops the background flush
+	done chan struct{}
+	// flushed is closed once the background flush stopped
+	flushed chan struct{}
+}
+
+// newAsyncWriter wraps w in a buffered writer flushed every interval and on Close.
+//
+// Parameters:
+//   - w: The underlying writer, closed by Close
+//   - interval: The delay between two background flushes
+//
+// Returns:
+//   - The asynchronous writer
+func newAsyncWriter(w io.WriteCloser, interval time.Duration) *asyncWriter {
+	aw := &asyncWriter{
+		buf:     bufio.NewWriterSize(w, asyncLogBufferSize),
+		w:       w,
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	go aw.flushLoop(interval)
+	return aw
+}
+
+// Write buffers p, it is written to the underlying writer by the next flush or when the buffer is full.
+//
+// Parameters:
+//   - p: The bytes to write
+//
+// Returns:
+//   - The number of bytes written
+//   - An error if the buffer couldn't be flushed to make room for p
+func (aw *asyncWriter) Write(p []byte) (int, error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	n, err := aw.buf.Write(p)
+	if err != nil {
+		aw.reset()
+	}
+	return n, err
+}
+
+// Flush writes the buffered bytes to the underlying writer.
+//
+// Returns:
+//   - An error if the underlying write failed
+func (aw *asyncWriter) Flush() error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	err := aw.buf.Flush()
+	if err != nil {
+		aw.reset()
+	}
+	return err
+}
+
+// reset drops the buffered bytes after a failed write, bufio.Writer failing every following write otherwise.
+// The caller must hold mu.
+func (aw *asyncWriter) reset() {
+	aw.buf.Reset(aw.w)
+}
+
+// Close stops the background flush, flushes the remaining buffered bytes and closes the underlying writer.
+//
+// Returns:
+//   - An error if the final flush or the close failed
+func (aw *asyncWriter) Close() error {
+	close(aw.done)
+	<-aw.flushed
+	err := aw.Flush()
+	if closeErr := aw.w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// flushLoop flushes the buffer every interval until Close is called.
+//
+// Parameters:
+//   - interval: The delay between two flushes
+func (aw *asyncWriter) flushLoop(interval time.Duration) {
+	defer close(aw.flushed)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-aw.done:
+			return
+		case <-ticker.C:
+			// A failed flush drops the buffered lines, there is nowhere left to report it
+			_ = aw.Flush()
+		}
+	}
+}
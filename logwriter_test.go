@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BenchmarkLogWriter measures logging a 100-byte line through the log package from parallel goroutines, into the
+// log file directly and through the asynchronous writer of LOG_ASYNC. The direct writes issue one write system call
+// per line, the asynchronous writer one per 64KB.
+func BenchmarkLogWriter(b *testing.B) {
+	line := strings.Repeat("x", 100)
+	for _, async := range []bool{false, true} {
+		name := "sync"
+		if async {
+			name = "async"
+		}
+		b.Run(name, func(b *testing.B) {
+			logFile, err := openLogFile(newTestConfig(b, map[string]string{"LOG_DIR": b.TempDir()}), time.UTC)
+			if err != nil {
+				b.Fatalf("openLogFile: %v", err)
+			}
+			var w io.WriteCloser = logFile
+			if async {
+				w = newAsyncWriter(logFile, asyncLogFlushInterval)
+			}
+			defer w.Close()
+			logger := log.New(w, "", log.LstdFlags|log.Lshortfile)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					logger.Print(line)
+				}
+			})
+			b.StopTimer()
+		})
+	}
+}
@@ -2,21 +2,35 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"math"
 	"net"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -26,159 +40,758 @@ import (
 type Application struct {
 	// Server is the gRPC server
 	server *grpc.Server
-	// NetListener is the network listener
-	netListener net.Listener
-	// tidbDatabase is the TiDB database
+	// healthServer is the standard gRPC health service
+	healthServer *health.Server
+	// netListeners are the network listeners the gRPC server serves on, several with GRPC_LISTENERS on Linux
+	netListeners []net.Listener
+	// httpServers are the auxiliary HTTP servers for metrics and probes, keyed by listen address
+	httpServers map[string]*httpServer
+	// stopStreams is closed by stop once the drain timed out, asking the long-lived stream handlers to return
+	// during SHUTDOWN_STREAM_GRACE, see streamsStopping
+	stopStreams chan struct{}
+	// errCh receives the error of the gRPC or an HTTP server stopping to serve unexpectedly, created by start.
+	// The application should be stopped when it receives one
+	errCh chan error
+	// dbMu protects tidbDatabase and readDatabase, set later by the background reconnection when DB_REQUIRED=false
+	dbMu sync.RWMutex
+	// tidbDatabase is the TiDB database, nil until connected, use primaryDB to access it
 	tidbDatabase *gorm.DB
-	// logFile is the log file
-	logFile *os.File
+	// readDatabase is the TiDB read replica, nil when TIDB_READ_HOST is unset, use readDB to access it
+	readDatabase *gorm.DB
+	// logFile is the log file, rotated when it exceeds the configured size
+	logFile io.WriteCloser
+	// logger is the structured logger, writing JSON lines when LOG_FORMAT=json and through the log package otherwise
+	logger *slog.Logger
+	// logLevel is the minimum level of the structured log records, changed by reload
+	logLevel *slog.LevelVar
+	// rateLimiter is the per client IP rate limiter, its limits are changed by reload
+	rateLimiter *ipRateLimiter
+	// dbBreaker rejects the database operations while the database looks overloaded
+	dbBreaker *circuitBreaker
+	// recordCache caches the records read by GetRecord, nil when CACHE_SIZE is 0
+	recordCache *recordCache
+	// recordLookups coalesces the concurrent GetRecord queries of the same key, see lookupRecord
+	recordLookups singleflight.Group
+	// featureFlags are the FEATURE_* flags read by Feature, replaced by reload
+	featureFlags atomic.Pointer[map[string]bool]
+	// idempotencyStore stores the responses replayed for a repeated idempotency key, in memory unless
+	// set with WithIdempotencyStore
+	idempotencyStore IdempotencyStore
+	// auditSink stores the audit events of the mutating RPCs, built from AUDIT_LOG_PATH or AUDIT_DATABASE unless
+	// injected with WithAuditSink, nil disables the audit
+	auditSink AuditSink
+	// registrar announces the instance to the service discovery, set from CONSUL_ADDR or with WithRegistrar,
+	// nil when the instance isn't registered
+	registrar ServiceRegistrar
+	// configPaths are the environment files the configuration is loaded from, read again by reload
+	configPaths []string
+	// config is the configuration the application was set up with
+	config *Config
+	// shutdownMu protects shutdownFuncs and stopped, the background database reconnection registering connections too
+	shutdownMu sync.Mutex
+	// shutdownFuncs release the resources opened during setup, run in reverse order by stop
+	shutdownFuncs []namedShutdown
+	// stopped is set once stop ran the shutdown functions, a resource opened afterwards is released right away
+	stopped bool
+	// shutdownCtx is canceled when stop begins, ending the background work that would open new resources
+	shutdownCtx context.Context
+	// cancelShutdown cancels shutdownCtx
+	cancelShutdown context.CancelFunc
+
+	// registerServices registers the application services on the gRPC server, registerMyService unless replaced
+	// with WithRegisterServices
+	registerServices func(server *grpc.Server, app *Application)
+	// extraUnaryInterceptors are the unary interceptors added with WithUnaryInterceptors, innermost in the chain
+	extraUnaryInterceptors []grpc.UnaryServerInterceptor
+	// extraStreamInterceptors are the stream interceptors added with WithStreamInterceptors, innermost in the chain
+	extraStreamInterceptors []grpc.StreamServerInterceptor
+
+	// OnStart hooks run in order by start once the listeners are ready, before serving.
+	// Use them to warm caches or register with service discovery, a failing hook aborts the startup
+	OnStart []func(ctx context.Context) error
+	// OnFlush hooks run in order right before the server is drained, within SHUTDOWN_FLUSH_TIMEOUT, to flush the
+	// traces and push the metrics while the process is still whole. A failing hook is logged and doesn't block the
+	// shutdown. setup adds the tracer flush with an OTLP collector and the push of PUSHGATEWAY_URL
+	OnFlush []func(ctx context.Context) error
+	// OnStop hooks run in order at the beginning of stop, before the server is drained.
+	// A failing hook is logged and doesn't block the shutdown, ctx is done after SHUTDOWN_HOOKS_TIMEOUT
+	// and a hook should bound its own cleanup with it
+	OnStop []func(ctx context.Context) error
 }
 
+// defaultGRPCMaxRecvMsgSize is the receive message size limit gRPC applies when none is configured.
+const defaultGRPCMaxRecvMsgSize = 4 * 1024 * 1024
+
 // MyService is the gRPC service struct
 // It contains a reference to the Application struct for accessing setup resources from the service methods.
 type MyService struct {
 	myservice.UnimplementedMyServiceServer
 	app *Application
+	// records holds the business logic of the record RPCs
+	records *RecordService
 }
 
 // TableRecord is a struct representing a record in the database table.
 // It contains fields for the record columns.
 // The struct tags define the column names and constraints for the GORM library.
-// The A field is the primary key and unique index, while the B field is a regular column.
+// The A field is the primary key and unique index, a varchar(255) column, while the B field is a regular column.
+// The CreatedAt and UpdatedAt fields are set by GORM when the record is created and updated, and CreatedBy is the
+// subject of the authenticated principal that created it, empty without authentication.
+// The DeletedAt field enables GORM soft deletes: Delete sets it instead of removing the row,
+// and the queries ignore the rows where it is set unless they are Unscoped.
 type TableRecord struct {
-	A string `gorm:"column:a;primaryKey,uniqueIndex"`
-	B int32  `gorm:"column:B"`
+	A         string         `gorm:"column:a;primaryKey;uniqueIndex;size:255"`
+	B         int32          `gorm:"column:B"`
+	CreatedBy string         `gorm:"column:created_by;size:255"`
+	CreatedAt time.Time      `gorm:"column:created_at"`
+	UpdatedAt time.Time      `gorm:"column:updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
+}
+
+// RecordAttribute is a struct representing a key/value attribute of a TableRecord, stored from the MyRequest.D map.
+// The RecordA and Name fields form the primary key, RecordA referencing the A column of the owning TableRecord.
+type RecordAttribute struct {
+	RecordA string `gorm:"column:record_a;primaryKey;size:255"`
+	Name    string `gorm:"column:name;primaryKey"`
+	Value   string `gorm:"column:value"`
 }
 
-// setup method initializes the application by loading configuration from an environment file,
+// Option customizes the Application built by New.
+type Option func(app *Application)
+
+// WithDatabase makes the application use db as its database instead of connecting to the configured one,
+// e.g. a GORM connection on top of sqlmock in tests. The read replica settings are ignored, db serving the reads too,
+// and db is not closed by stop.
+//
+// Parameters:
+//   - db: The database connection
+//
+// Returns:
+//   - The option
+func WithDatabase(db *gorm.DB) Option {
+	return func(app *Application) {
+		app.tidbDatabase = db
+	}
+}
+
+// WithListener makes the application serve gRPC on lis instead of listening on the configured address,
+// e.g. a bufconn listener in tests. The listener is closed by stop.
+//
+// Parameters:
+//   - lis: The listener to serve on
+//
+// Returns:
+//   - The option
+func WithListener(lis net.Listener) Option {
+	return func(app *Application) {
+		app.netListeners = []net.Listener{lis}
+	}
+}
+
+// WithUnaryInterceptors adds unary interceptors to the server, chained in order after the built-in ones,
+// closest to the handlers. See unaryInterceptors for the full chain.
+//
+// Parameters:
+//   - interceptors: The interceptors to add
+//
+// Returns:
+//   - The option
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(app *Application) {
+		app.extraUnaryInterceptors = append(app.extraUnaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors adds stream interceptors to the server, chained in order after the built-in ones,
+// closest to the handlers. See streamInterceptors for the full chain.
+//
+// Parameters:
+//   - interceptors: The interceptors to add
+//
+// Returns:
+//   - The option
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(app *Application) {
+		app.extraStreamInterceptors = append(app.extraStreamInterceptors, interceptors...)
+	}
+}
+
+// WithIdempotencyStore replaces the in-memory store of the responses replayed for a repeated idempotency-key,
+// e.g. with a store shared by every replica of the service.
+//
+// Parameters:
+//   - store: The idempotency store
+//
+// Returns:
+//   - The option
+func WithIdempotencyStore(store IdempotencyStore) Option {
+	return func(app *Application) {
+		app.idempotencyStore = store
+	}
+}
+
+// WithAuditSink writes the audit events of the mutating RPCs to sink instead of the AUDIT_LOG_PATH file or the
+// AUDIT_DATABASE table, enabling the audit even when neither is set.
+//
+// Parameters:
+//   - sink: The audit sink
+//
+// Returns:
+//   - The option
+func WithAuditSink(sink AuditSink) Option {
+	return func(app *Application) {
+		app.auditSink = sink
+	}
+}
+
+// WithRegistrar makes the application register itself with registrar instead of the Consul agent of CONSUL_ADDR,
+// e.g. with an etcd backed registrar.
+//
+// Parameters:
+//   - registrar: The service registrar
+//
+// Returns:
+//   - The option
+func WithRegistrar(registrar ServiceRegistrar) Option {
+	return func(app *Application) {
+		app.registrar = registrar
+	}
+}
+
+// WithRegisterServices replaces the registration of the application services on the gRPC server, by default
+// registerMyService, e.g. to attach the services of additional proto files. The health and reflection services are
+// registered by setup in any case. Call registerMyService from register to keep serving MyService.
+//
+// Parameters:
+//   - register: The function registering the services on the server
+//
+// Returns:
+//   - The option
+func WithRegisterServices(register func(server *grpc.Server, app *Application)) Option {
+	return func(app *Application) {
+		app.registerServices = register
+	}
+}
+
+// registerMyService is the default service registration, registering the MyService server.
+//
+// Parameters:
+//   - server: The gRPC server
+//   - app: The application the service accesses its resources from
+func registerMyService(server *grpc.Server, app *Application) {
+	myservice.RegisterMyServiceServer(server, &MyService{app: app, records: newRecordService(app)})
+}
+
+// New builds an application set up from an already loaded configuration, ready to be started.
+// It separates the wiring from the environment loading, so tests can build a server from a Config
+// of their own, against a test database injected with WithDatabase.
+//
+// Parameters:
+//   - cfg: The application configuration, as returned by LoadConfig or built by the caller
+//   - opts: The options customizing the application
+//
+// Returns:
+//   - The application
+//   - An error if the setup failed, the resources opened so far are released then
+func New(cfg *Config, opts ...Option) (*Application, error) {
+	app := &Application{registerServices: registerMyService}
+	for _, opt := range opts {
+		opt(app)
+	}
+	if err := app.setup(cfg); err != nil {
+		log.Printf("setup failed: %v", err)
+		runShutdownPhase("cleanup", cfg.ShutdownCleanupTimeout, app.runShutdownFuncs)
+		if app.logFile != nil {
+			app.logFile.Close()
+		}
+		return nil, err
+	}
+	cfg.logStartup(app.logger)
+	return app, nil
+}
+
+// setup method initializes the application from the loaded configuration,
 // setting up logging to a file, creating a gRPC server, and connecting to a TiDB database.
 //
 // Parameters:
-//   - configPath: The path to the environment configuration file
+//   - cfg: The application configuration, as returned by LoadConfig
 //
 // Returns:
 //   - An error if the setup process fails
-func (app *Application) setup(configPath string) error {
-	err := godotenv.Load(configPath)
+func (app *Application) setup(cfg *Config) error {
+	var err error
+	app.config = cfg
+	app.stopStreams = make(chan struct{})
+	app.shutdownCtx, app.cancelShutdown = context.WithCancel(context.Background())
+	app.setFeatureFlags(cfg.FeatureFlags)
+
+	// Open log file with date in filename, rolling over to a timestamped backup when it exceeds the maximum size.
+	// The date is taken in LOG_TIMEZONE so every instance of a distributed deployment names its files alike
+	logTimezone := cfg.LogTimezone
+	if logTimezone == nil {
+		logTimezone = time.UTC
+	}
+	logFile, err := openLogFile(cfg, logTimezone)
+	var logOutput io.Writer
+	switch {
+	case err == nil:
+		app.logFile = logFile
+		// Buffer the log lines and write them in the background, the buffer is flushed when stop closes the file
+		if cfg.LogAsync {
+			app.logFile = newAsyncWriter(logFile, asyncLogFlushInterval)
+		}
+		// Copy the lines to stdout for the container log collectors, only the file is closed by stop
+		logOutput = app.logFile
+		if cfg.LogToStdout {
+			logOutput = io.MultiWriter(app.logFile, os.Stdout)
+		}
+	case cfg.LogRequireFile:
+		return err
+	default:
+		// Keep serving in a read-only or restricted environment, the platform still collects stdout
+		fmt.Fprintf(os.Stderr, "Warning: %v, logging to stdout only\n", err)
+		logOutput = os.Stdout
+	}
+
+	// Configure the logger to include timestamps in LOG_TIMEZONE, which the log package flags can't do
+	log.SetOutput(&timestampWriter{w: logOutput, loc: logTimezone})
+	log.SetFlags(log.Lshortfile)
+
+	// Switch to structured JSON logging when requested, the log package output is then redirected to it as well
+	app.logLevel = &slog.LevelVar{}
+	app.logger, err = newLogger(cfg.LogFormat, logOutput, app.logLevel, logTimezone)
 	if err != nil {
 		return err
 	}
-	// Set up logging to file
-	logDir := os.Getenv("LOG_DIR")
-	if logDir == "" {
-		logDir = "logs"
+	if app.logger != nil {
+		slog.SetDefault(app.logger)
+	} else {
+		app.logger = slog.Default()
+	}
+	app.setLogLevel(cfg.LogLevel)
+
+	log.Printf("Starting version=%s commit=%s build_date=%s", version, commit, buildDate)
+	if len(cfg.FeatureFlags) > 0 {
+		log.Printf("Feature flags: %v", cfg.FeatureFlags)
+	}
+	fitShutdownToGracePeriod(cfg)
+	log.Printf("Shutdown timeouts set to hooks=%s flush=%s drain=%s stream_grace=%s cleanup=%s",
+		cfg.ShutdownHooksTimeout, cfg.ShutdownFlushTimeout, cfg.ShutdownTimeout, cfg.ShutdownStreamGrace, cfg.ShutdownCleanupTimeout)
+	if cfg.ShutdownPredrain > 0 {
+		log.Printf("Shutdown pre-drain delay set to %s", cfg.ShutdownPredrain)
 	}
 
-	// Create logs directory if it doesn't exist
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create log directory: %w", err)
+	// Export traces when an OTLP collector is configured
+	if err := app.setupTracing(cfg.OTLPEndpoint); err != nil {
+		return err
 	}
+	// Push the metrics on shutdown when a pushgateway is configured
+	app.setupPushgateway(cfg.PushgatewayURL, cfg.PushgatewayJob)
 
-	// Open log file with date in filename
-	timestamp := time.Now().Format("2006-01-02")
-	logPath := filepath.Join(logDir, fmt.Sprintf("my-server-%s.log", timestamp))
-	app.logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %w", err)
+	// Build the interceptor chains, see unaryInterceptors for the order. The rate limiter is always installed
+	// so a reload can enable rate limiting later
+	app.rateLimiter = newIPRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	if cfg.APIToken != "" {
+		log.Printf("Bearer token authentication enabled, skipped methods: %v", cfg.AuthSkipMethods)
+	}
+	if len(cfg.MethodScopes) > 0 {
+		log.Printf("Method authorization enabled, required scopes: %v", cfg.MethodScopes)
+	}
+	if cfg.LogPayloads {
+		log.Printf("WARNING: payload logging enabled, the logs hold the request and response messages, which can contain personal data; redacted fields: %v",
+			cfg.LogPayloadRedactFields)
+	}
+	if cfg.RateLimitRPS > 0 {
+		log.Printf("Rate limiting enabled: rps=%g burst=%d", cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+	if cfg.GRPCCompression != "" {
+		log.Printf("Response compression enabled: %s, unary responses from %d bytes", cfg.GRPCCompression, cfg.GRPCCompressionMinSize)
+	}
+	if cfg.ServerMethodTimeout > 0 || len(cfg.ServerMethodTimeouts) > 0 {
+		log.Printf("Method timeouts enabled: default=%s overrides=%v", cfg.ServerMethodTimeout, cfg.ServerMethodTimeouts)
+	}
+	if cfg.IdempotencyTTL > 0 {
+		if app.idempotencyStore == nil {
+			app.idempotencyStore = newMemoryIdempotencyStore(cfg.IdempotencyMaxEntries)
+			log.Printf("Idempotency keys enabled: ttl=%s max_entries=%d", cfg.IdempotencyTTL, cfg.IdempotencyMaxEntries)
+		} else {
+			log.Printf("Idempotency keys enabled with a custom store: ttl=%s", cfg.IdempotencyTTL)
+		}
+	}
+	switch {
+	case app.auditSink != nil:
+		log.Println("Audit log enabled with a custom sink")
+	case cfg.AuditLogPath != "":
+		sink, err := openFileAuditSink(cfg.AuditLogPath)
+		if err != nil {
+			return err
+		}
+		app.auditSink = sink
+		app.addCloser("audit log", sink)
+		log.Printf("Audit log enabled: %s", cfg.AuditLogPath)
+	case cfg.AuditDatabase:
+		app.auditSink = &databaseAuditSink{app: app}
+		log.Println("Audit log enabled: audit_records table")
+	}
+	serverOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(app.unaryInterceptors()...),
+		grpc.ChainStreamInterceptor(app.streamInterceptors()...),
 	}
 
-	// Configure the logger to write to file and include timestamps
-	log.SetOutput(app.logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
+	// Create a server span for every RPC, continuing the trace propagated by the client
+	if cfg.OTLPEndpoint != "" {
+		serverOptions = append(serverOptions, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
 
-	// Create gRPC server
-	app.server = grpc.NewServer()
-	// Register the MyService server
-	myservice.RegisterMyServiceServer(
-		app.server,
-		&MyService{app: app},
+	// Ping idle connections to detect half-open ones, and disconnect clients pinging too aggressively
+	serverOptions = append(serverOptions,
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.GRPCKeepaliveTime,
+			Timeout: cfg.GRPCKeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: cfg.GRPCKeepaliveMinTime,
+		}),
 	)
-	// Listen on the specified port
-	app.netListener, err = net.Listen("tcp", ":"+os.Getenv("GRPC_LISTEN_PORT"))
-	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
-		return err
+	log.Printf("Keepalive configured: time=%s timeout=%s min_time=%s",
+		cfg.GRPCKeepaliveTime, cfg.GRPCKeepaliveTimeout, cfg.GRPCKeepaliveMinTime)
+
+	// Override the gRPC message size limits when configured
+	if cfg.GRPCMaxRecvMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(cfg.GRPCMaxRecvMsgSize))
+		log.Printf("Maximum receive message size set to %d bytes", cfg.GRPCMaxRecvMsgSize)
+	} else {
+		log.Printf("Maximum receive message size set to the gRPC default of %d bytes", defaultGRPCMaxRecvMsgSize)
 	}
-	// Connect to the TiDB database
-	tidbConnectionString := os.Getenv("TIDB_USER") + ":@tcp(" + os.Getenv("TIDB_HOST") + ":" + os.Getenv("TIDB_PORT") + ")/" + os.Getenv("TIDB_DATABASE") + "?parseTime=true"
-	app.tidbDatabase, err = gorm.Open(mysql.Open(tidbConnectionString), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("failed to connect to TiDB: %v", err)
+	if cfg.GRPCMaxSendMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxSendMsgSize(cfg.GRPCMaxSendMsgSize))
+		log.Printf("Maximum send message size set to %d bytes", cfg.GRPCMaxSendMsgSize)
+	} else {
+		log.Printf("Maximum send message size set to the gRPC default of %d bytes", math.MaxInt32)
+	}
+
+	// Cap the concurrent RPCs of every connection when configured, the following ones wait for a free stream
+	if cfg.GRPCMaxConcurrentStreams > 0 {
+		serverOptions = append(serverOptions, grpc.MaxConcurrentStreams(cfg.GRPCMaxConcurrentStreams))
+		log.Printf("Maximum concurrent streams per connection set to %d", cfg.GRPCMaxConcurrentStreams)
+	}
+
+	// Enable TLS when the certificate and the key file are configured, otherwise keep serving plaintext.
+	// Client certificates are required too when a client CA file is configured
+	if cfg.TLSCertFile != "" {
+		creds, err := newServerTLSCredentials(cfg)
+		if err != nil {
+			return err
+		}
+		serverOptions = append(serverOptions, grpc.Creds(creds))
+		log.Printf("TLS enabled with certificate %s", cfg.TLSCertFile)
+		if cfg.TLSClientCAFile != "" {
+			log.Printf("Mutual TLS enabled, client certificates verified against %s", cfg.TLSClientCAFile)
+		}
+	}
+
+	// Create gRPC server
+	app.server = grpc.NewServer(serverOptions...)
+	// Register the application services, MyService unless replaced with WithRegisterServices
+	app.registerServices(app.server, app)
+	// Register the health service, reporting NOT_SERVING until the database is reachable
+	app.healthServer = health.NewServer()
+	healthpb.RegisterHealthServer(app.server, app.healthServer)
+	app.setServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	// Register server reflection only when explicitly enabled, it exposes the full service schema
+	if cfg.EnableReflection {
+		reflection.Register(app.server)
+		log.Println("gRPC server reflection enabled")
+	}
+	// Listen on the configured address, or on the configured port of every interface,
+	// unless a listener was injected with WithListener
+	if len(app.netListeners) == 0 {
+		app.netListeners, err = listenGRPC(cfg)
+		if err != nil {
+			return err
+		}
+		// Unlink the unix socket once the listeners are closed, registered first so it runs after them
+		if network, address := cfg.listenAddress(); network == "unix" {
+			app.addShutdown("unix socket "+address, func(context.Context) error {
+				return removeUnixSocket(address)
+			})
+		}
+	}
+	app.addShutdown("gRPC listeners", func(context.Context) error {
+		// GracefulStop and Stop usually closed them already
+		return closeListeners(app.netListeners)
+	})
+	// Expose Prometheus metrics over HTTP when a metrics port is configured
+	if cfg.MetricsPort != 0 {
+		mux, err := app.httpMux("metrics server", ":"+strconv.Itoa(cfg.MetricsPort))
+		if err != nil {
+			return err
+		}
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+	// Expose the HTTP liveness and readiness probes, sharing the metrics server when on the same port
+	if cfg.HealthHTTPPort != 0 {
+		mux, err := app.httpMux("health server", ":"+strconv.Itoa(cfg.HealthHTTPPort))
+		if err != nil {
+			return err
+		}
+		mux.HandleFunc("/healthz", app.handleHealthz)
+		mux.HandleFunc("/readyz", app.handleReadyz)
+	}
+	// Expose the profiling endpoints when enabled, on their own server bound to localhost unless PPROF_HOST says
+	// otherwise, so they aren't reachable from the network by default
+	if cfg.EnablePprof {
+		addr := net.JoinHostPort(cfg.PprofHost, strconv.Itoa(cfg.PprofPort))
+		mux, err := app.httpMux("pprof server", addr)
+		if err != nil {
+			return err
+		}
+		registerPprof(mux)
+		log.Printf("pprof enabled on http://%s/debug/pprof/", addr)
+	}
+	// Expose MyService as REST/JSON when a gateway port is configured, sharing the metrics and probes server when
+	// on the same port
+	if cfg.HTTPGatewayPort != 0 {
+		if err := app.setupGateway(); err != nil {
+			return err
+		}
+	}
+	// Register with the Consul agent when configured, unless a registrar was injected with WithRegistrar
+	if app.registrar == nil && cfg.ConsulAddr != "" {
+		instance, err := newServiceInstance(cfg)
+		if err != nil {
+			return err
+		}
+		app.registrar = newConsulRegistrar(cfg.ConsulAddr, instance)
+	}
+	log.Printf("Database retry policy: max_retries=%d base_delay=%s", cfg.DBRetryMax, cfg.DBRetryBaseDelay)
+	app.dbBreaker = newCircuitBreaker(cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+	if cfg.DBBreakerThreshold > 0 {
+		log.Printf("Database circuit breaker enabled: threshold=%d cooldown=%s", cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+	}
+	app.recordCache = newRecordCache(cfg.CacheSize, cfg.CacheTTL)
+	if cfg.CacheSize > 0 {
+		log.Printf("Record cache enabled: size=%d ttl=%s", cfg.CacheSize, cfg.CacheTTL)
+	}
+	// Use the database injected with WithDatabase, e.g. a sqlmock one in tests, instead of connecting
+	if app.primaryDB() != nil {
+		if cfg.MultiTenant {
+			if err := registerTenantScope(app.primaryDB()); err != nil {
+				return err
+			}
+		}
+		if cfg.DBQueryComments {
+			// Every request ID makes a new statement text, each one would be prepared and cached once per connection
+			if app.primaryDB().PrepareStmt {
+				return errors.New("DB_QUERY_COMMENTS requires a WithDatabase connection opened without PrepareStmt")
+			}
+			if err := registerQueryComments(app.primaryDB()); err != nil {
+				return err
+			}
+		}
+		if err := app.migrateSchema(app.primaryDB()); err != nil {
+			return err
+		}
+		app.setServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_SERVING)
+		return nil
+	}
+	// Serve without any database when disabled, the handlers needing it return codes.FailedPrecondition
+	if !cfg.DBEnabled {
+		log.Println("Database disabled, serving the methods that don't need it only")
+		app.setServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		app.setServingStatus(myServiceName, healthpb.HealthCheckResponse_SERVING)
+		return nil
+	}
+	// Connect to the databases, or keep connecting in the background while serving when they are optional
+	if err := app.connectDatabases(); err != nil {
+		if cfg.DBRequired {
+			return err
+		}
+		log.Printf("Database unavailable, serving without it until it connects: %v", err)
+		app.reconnectDatabases()
 	}
 	return nil
 }
 
-// start method starts the gRPC server and listens for incoming requests.
-func (app *Application) start() {
-	log.Printf("Server listening on port %s", os.Getenv("GRPC_LISTEN_PORT"))
-	if err := app.server.Serve(app.netListener); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+// start method runs the OnStart hooks, then starts the gRPC server in the background to serve incoming requests
+// and registers the instance with the service discovery. A server failing while serving reports its error on errCh
+// instead of exiting the process, so the caller can shut down cleanly.
+//
+// Returns:
+//   - An error if an OnStart hook failed, the server is not started then, or if the registration failed
+func (app *Application) start() error {
+	if err := app.runStartHooks(context.Background()); err != nil {
+		return err
 	}
-
+	// Buffered so every server can report its failure without blocking, even if nobody reads them
+	app.errCh = make(chan error, len(app.netListeners)+len(app.httpServers))
+	// Serve metrics and probes in the background
+	app.startHTTPServers()
+	// Serve the same gRPC server on every listener, each accepting its connections in its own goroutine
+	for _, lis := range app.netListeners {
+		log.Printf("Server listening on %s %s", lis.Addr().Network(), lis.Addr())
+		go func() {
+			// Serve returns nil once stop called GracefulStop or Stop
+			if err := app.server.Serve(lis); err != nil {
+				app.errCh <- fmt.Errorf("gRPC server failed to serve on %s: %w", lis.Addr(), err)
+			}
+		}()
+	}
+	// Announce the instance once it serves, so the discovered clients don't hit a closed port
+	return app.registerService(context.Background())
 }
 
-// stop method stops the gRPC server gracefully by calling GracefulStop with a timeout.
+// stop method shuts the application down in phases, each with its own timeout so a hung shutdown tells
+// a stuck RPC apart from a stuck resource: the OnStop hooks within SHUTDOWN_HOOKS_TIMEOUT, the OnFlush hooks within
+// SHUTDOWN_FLUSH_TIMEOUT, the gRPC server drain with GracefulStop within SHUTDOWN_TIMEOUT, the streams still open asked to return within SHUTDOWN_STREAM_GRACE
+// before Stop closes the connections, then the release of the other resources within SHUTDOWN_CLEANUP_TIMEOUT.
 func (app *Application) stop() {
 	log.Println("Stopping server gracefully...")
+	// Stop the background database reconnection, a database connecting now would only be closed again
+	app.cancelShutdown()
 
-	// Create a timeout context
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Deregister from the service discovery and run the stop hooks first, while still serving
+	if len(app.OnStop) > 0 || app.registrar != nil {
+		runShutdownPhase("stop hooks", app.config.ShutdownHooksTimeout, func(ctx context.Context) {
+			app.deregisterService(ctx)
+			app.runStopHooks(ctx)
+		})
+	}
+
+	// Report NOT_SERVING for every service before draining, so load balancers stop routing new requests
+	// while the in-flight ones complete
+	app.healthServer.Shutdown()
+	if app.config.ShutdownPredrain > 0 {
+		log.Printf("Waiting %s for load balancers to notice the NOT_SERVING status", app.config.ShutdownPredrain)
+		time.Sleep(app.config.ShutdownPredrain)
+	}
+
+	// Flush the traces and the metrics before the drain, so a drain cut short still leaves them exported
+	if len(app.OnFlush) > 0 {
+		runShutdownPhase("flush", app.config.ShutdownFlushTimeout, app.runFlushHooks)
+	}
 
-	// Use GracefulStop with deadline
+	// Drain the in-flight RPCs and streams. GracefulStop sends GOAWAY and closes the listeners right away, so no new
+	// RPC starts, then waits for the in-flight ones
 	stopped := make(chan struct{})
 	go func() {
 		app.server.GracefulStop()
-
 		close(stopped)
 	}()
-
-	select {
-	case <-stopped:
+	waitStopped := func(ctx context.Context) {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+		}
+	}
+	drained := runShutdownPhase("drain", app.config.ShutdownTimeout, waitStopped)
+	// Ask the streams still open to return, e.g. a client holding a long-lived stream, and give them a last grace
+	// before closing the connections
+	if !drained && app.config.ShutdownStreamGrace > 0 {
+		log.Printf("Asking the remaining streams to finish within %s", app.config.ShutdownStreamGrace)
+		close(app.stopStreams)
+		drained = runShutdownPhase("stream grace", app.config.ShutdownStreamGrace, waitStopped)
+	}
+	if drained {
 		log.Println("Server stopped gracefully")
-	case <-ctx.Done():
+	} else {
 		log.Println("Force stopping server due to timeout")
 		app.server.Stop()
 	}
-	// Close network listener
-
-	if err := app.netListener.Close(); err != nil {
-		log.Printf("Error closing listener: %v", err)
-	}
-	// Close database connection
-	sqlDB, err := app.tidbDatabase.DB()
-	if err == nil {
-		sqlDB.Close()
-		log.Println("Database connection closed")
-	}
-	// Close log file
+	// Release the other resources
+	runShutdownPhase("cleanup", app.config.ShutdownCleanupTimeout, app.runShutdownFuncs)
+	// Close log file last so every shutdown step is logged
+	log.Println("Server shutdown complete")
 	if app.logFile != nil {
 		app.logFile.Close()
 	}
-	log.Println("Server shutdown complete")
+}
+
+// Run method starts serving and blocks until ctx is cancelled or a server fails, then shuts the application down
+// with stop. It lets a larger process embed the server and own the signal handling, cancelling ctx to stop it.
+// Call it once, instead of start and stop.
+//
+// Parameters:
+//   - ctx: The context whose cancellation stops the application
+//
+// Returns:
+//   - nil once ctx was cancelled and the application stopped, or the first error: the start failure, the
+//     application being stopped right away then, or the failure of a server while serving
+func (app *Application) Run(ctx context.Context) error {
+	// Release what setup opened when a start hook fails
+	if err := app.start(); err != nil {
+		log.Printf("start failed: %v", err)
+		app.stop()
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		app.stop()
+		return nil
+	case err := <-app.errCh:
+		log.Printf("Server failed, shutting down: %v", err)
+		app.stop()
+		return err
+	}
 }
 
 func main() {
-	app := Application{}
-	err := app.setup("test.env")
+	validateOnly := flag.Bool("validate", false, "validate the configuration, print the resolved settings and exit")
+	flag.Parse()
+
+	configPaths := configFiles()
+	cfg, err := LoadConfig(configPaths...)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Stop before binding the port or connecting to the database in validation mode, e.g. before a deploy
+	if *validateOnly || (&envLoader{}).bool("VALIDATE_ONLY", false) {
+		cfg.writeSummary(os.Stdout)
+		fmt.Println("Configuration is valid")
 		return
 	}
+	app, err := New(cfg)
+	if err != nil {
+		// New returns instead of exiting so callers and tests can handle failures, main gives up here
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	app.configPaths = configPaths
 
 	// Set up signal handling first
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, append([]os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}, logLevelSignals...)...)
 
-	// Start server in a goroutine
-	go app.start()
+	// Reload the configuration on SIGHUP and change the log level on SIGUSR1 and SIGUSR2, until a termination signal
+	// cancels the context Run serves with
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				app.reload()
+				continue
+			}
+			if app.handleLogLevelSignal(sig) {
+				continue
+			}
+			cancel()
+			return
+		}
+	}()
 
-	// Wait for termination signal
-	<-c
-	app.stop()
+	if err := app.Run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-// function MyMethod receives a request, creates a record in the database, and returns a response.
+// function MyMethod receives a request, creates a record and its attributes in the database, and returns a response.
+// It converts the request for RecordService.CreateRecord, which holds the validation, the transaction and the error
+// mapping.
 //
 // Parameters:
 //   - ctx: The context of the request
@@ -188,13 +801,322 @@ func main() {
 //   - The response message
 //   - An error if the operation failed
 func (s *MyService) MyMethod(ctx context.Context, req *myservice.MyRequest) (*myservice.MyResponse, error) {
-	// Perform some operation
-	record := TableRecord{A: req.A, B: req.B}
-	result := s.app.tidbDatabase.Create(&record)
-	if result.Error != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create record: %v", result.Error)
+	if _, err := s.records.CreateRecord(ctx, req.GetA(), req.GetB(), req.GetD()); err != nil {
+		return nil, err
 	}
 
 	// Return response
 	return &myservice.MyResponse{Message: "success"}, nil
 }
+
+// function CreateRecords creates records and their attributes in batches of DB_BATCH_SIZE rows, each batch in its own
+// transaction. A failing batch is retried one record at a time, so the response reports the outcome of every record
+// instead of aborting the others. With transactional set, every record is created in a single transaction and the first
+// invalid record or failure fails the whole call, leaving the database untouched.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//
+// Returns:
+//   - The result of every record, in request order, and the number of records created
+//   - An error if the request is invalid, the call was cancelled, or the transactional creation failed
+func (s *MyService) CreateRecords(ctx context.Context, req *myservice.CreateRecordsRequest) (*myservice.CreateRecordsResponse, error) {
+	records := req.GetRecords()
+	if len(records) == 0 {
+		return nil, errorWithInfo(codes.InvalidArgument, reasonInvalidArgument, "records is required", map[string]string{"field": "records"})
+	}
+	if err := s.app.databaseAvailable(); err != nil {
+		return nil, err
+	}
+
+	// Reject the invalid records before hitting the database, including the keys repeated in the request
+	results := make([]*myservice.RecordResult, len(records))
+	pending := make([]int, 0, len(records))
+	seen := make(map[string]int, len(records))
+	for i, record := range records {
+		results[i] = &myservice.RecordResult{A: record.GetA()}
+		err := validateMyRequest(record, s.app.config.RecordKeyMaxLength)
+		if first, ok := seen[record.GetA()]; err == nil && ok {
+			err = errorWithInfo(codes.InvalidArgument, reasonInvalidArgument,
+				fmt.Sprintf("a %q is already used by record %d", record.GetA(), first), map[string]string{"field": "a"})
+		}
+		if err != nil {
+			if req.GetTransactional() {
+				// Keep the details of the record error, prefixing its message with the record index
+				st := status.Convert(withErrorMetadata(err, "index", strconv.Itoa(i))).Proto()
+				st.Message = fmt.Sprintf("record %d: %s", i, st.GetMessage())
+				return nil, status.ErrorProto(st)
+			}
+			setRecordResult(results[i], err)
+			continue
+		}
+		seen[record.GetA()] = i
+		pending = append(pending, i)
+	}
+
+	batchSize := s.app.config.DBBatchSize
+	principal, _ := principalFromContext(ctx)
+	create := func(ctx context.Context, indexes []int) error {
+		return s.app.withRetry(ctx, func() error {
+			return s.app.inTransaction(ctx, func(tx *gorm.DB) error {
+				return createRecordRows(tx, records, indexes, principal.Subject, batchSize)
+			})
+		})
+	}
+	dbCtx, span := tracer.Start(ctx, "db.create_records")
+	var err error
+	// Invalidate whatever the outcome, a failed commit may have stored the records anyway
+	defer func() {
+		keys := make([]string, 0, len(pending))
+		for _, i := range pending {
+			keys = append(keys, recordCacheKey(ctx, records[i].GetA()))
+		}
+		s.app.invalidateRecords(keys...)
+	}()
+	if req.GetTransactional() {
+		err = create(dbCtx, pending)
+	} else {
+		for start := 0; start < len(pending) && err == nil; start += batchSize {
+			batch := pending[start:min(start+batchSize, len(pending))]
+			if create(dbCtx, batch) == nil {
+				continue
+			}
+			// Find the failing records of the batch, creating the others
+			for _, i := range batch {
+				setRecordResult(results[i], create(dbCtx, []int{i}))
+			}
+			// Stop when the client is gone or the deadline expired, the remaining records would fail the same way
+			err = dbCtx.Err()
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	var created int32
+	for _, result := range results {
+		if result.GetCode() == int32(codes.OK) {
+			created++
+		}
+	}
+	return &myservice.CreateRecordsResponse{Results: results, Created: created}, nil
+}
+
+// function StreamRecords streams the stored records ordered by their primary key.
+// It stops as soon as the client cancels the call or its deadline expires.
+//
+// Parameters:
+//   - req: The request message
+//   - stream: The server stream the records are sent to
+//
+// Returns:
+//   - An error if the query, the context, or sending a record failed
+func (s *MyService) StreamRecords(req *myservice.StreamRecordsRequest, stream grpc.ServerStreamingServer[myservice.Record]) error {
+	if err := s.app.databaseAvailable(); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	query := s.app.readDB().WithContext(ctx).Model(&TableRecord{}).Order("a")
+	if req.GetLimit() > 0 {
+		query = query.Limit(int(req.GetLimit()))
+	}
+	var rows *sql.Rows
+	err := s.app.dbBreaker.do(func() (err error) {
+		rows, err = query.Rows()
+		return err
+	})
+	if err != nil {
+		return toGRPCError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Stop reading rows once the client went away
+		if err := ctx.Err(); err != nil {
+			return toGRPCError(err)
+		}
+		// End the stream when the server shuts down, the client can resume after the last record it received
+		select {
+		case <-s.app.streamsStopping():
+			return errServerShuttingDown
+		default:
+		}
+		var record TableRecord
+		if err := s.app.readDB().ScanRows(rows, &record); err != nil {
+			return toGRPCError(err)
+		}
+		if err := stream.Send(&myservice.Record{A: record.A, B: record.B}); err != nil {
+			return err
+		}
+	}
+	return toGRPCError(rows.Err())
+}
+
+// function GetRecord returns the record with the given primary key. With CACHE_SIZE set, the records found are cached
+// for CACHE_TTL and the repeated reads of a key are served without querying the database. The concurrent reads of a
+// key the cache doesn't serve share a single query.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//
+// Returns:
+//   - The record
+//   - A codes.NotFound error if no record has this key, or another error if the operation failed
+func (s *MyService) GetRecord(ctx context.Context, req *myservice.GetRecordRequest) (*myservice.Record, error) {
+	if err := validateRecordKey(req.GetA(), s.app.config.RecordKeyMaxLength); err != nil {
+		return nil, err
+	}
+	if err := s.app.databaseAvailable(); err != nil {
+		return nil, err
+	}
+
+	// Serve the hot keys from the cache, only the found records are cached
+	cacheKey := recordCacheKey(ctx, req.GetA())
+	record, cached, generation := s.app.recordCache.get(cacheKey)
+	if cached {
+		return &myservice.Record{A: record.A, B: record.B}, nil
+	}
+	// The concurrent lookups of the key share a single query
+	dbCtx, span := tracer.Start(ctx, "db.get_record")
+	record, err := s.app.lookupRecord(dbCtx, cacheKey, req.GetA())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+	// A missing record is an expected outcome, not a failure turned into Internal
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, recordNotFoundError(req.GetA())
+	}
+	if err != nil {
+		return nil, withErrorMetadata(toGRPCError(err), "a", req.GetA())
+	}
+	s.app.recordCache.set(cacheKey, record, generation)
+	return &myservice.Record{A: record.A, B: record.B}, nil
+}
+
+// function DeleteRecord soft deletes the record with the given primary key, setting its deleted_at column so the row
+// is kept for audit while the read methods ignore it. With hard set, the record and its attributes are removed from
+// the table instead, in a single transaction so a failure leaves the record untouched.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//
+// Returns:
+//   - The response message
+//   - A codes.NotFound error if no record has this key, or another error if the operation failed
+func (s *MyService) DeleteRecord(ctx context.Context, req *myservice.DeleteRecordRequest) (*myservice.DeleteRecordResponse, error) {
+	if err := validateRecordKey(req.GetA(), s.app.config.RecordKeyMaxLength); err != nil {
+		return nil, err
+	}
+	if err := s.app.databaseAvailable(); err != nil {
+		return nil, err
+	}
+
+	dbCtx, span := tracer.Start(ctx, "db.delete_record")
+	err := s.app.withRetry(dbCtx, func() error {
+		return s.app.inTransaction(dbCtx, func(tx *gorm.DB) error {
+			// A soft deleted record keeps its attributes, a hard deleted one, soft deleted before or not, loses them
+			if req.GetHard() {
+				if err := tx.Where("record_a = ?", req.GetA()).Delete(&RecordAttribute{}).Error; err != nil {
+					return err
+				}
+				tx = tx.Unscoped()
+			}
+			result := tx.Where("a = ?", req.GetA()).Delete(&TableRecord{})
+			if result.Error != nil {
+				return result.Error
+			}
+			// Rolls back the attribute deletion above, although there shouldn't be any without the record
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		})
+	})
+	s.app.invalidateRecords(recordCacheKey(ctx, req.GetA()))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, recordNotFoundError(req.GetA())
+	}
+	if err != nil {
+		return nil, withErrorMetadata(toGRPCError(err), "a", req.GetA())
+	}
+	return &myservice.DeleteRecordResponse{Message: "success"}, nil
+}
+
+// function ListRecords returns one page of the stored records ordered by their primary key.
+// The page token is a cursor on the a column, so each page continues right after the last record of the previous one.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//
+// Returns:
+//   - The records of the page and the token of the next one
+//   - A codes.InvalidArgument error for a negative page size or a malformed token, or another error if the query failed
+func (s *MyService) ListRecords(ctx context.Context, req *myservice.ListRecordsRequest) (*myservice.ListRecordsResponse, error) {
+	size, err := pageSize(req.GetPageSize(), s.app.config.ListDefaultPageSize, s.app.config.ListMaxPageSize)
+	if err != nil {
+		return nil, err
+	}
+	lastA, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.app.databaseAvailable(); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra record to know whether another page follows
+	var records []TableRecord
+	dbCtx, span := tracer.Start(ctx, "db.list_records")
+	err = s.app.withRetry(dbCtx, func() error {
+		return s.app.readDB().WithContext(dbCtx).Where("a > ?", lastA).Order("a").Limit(size + 1).Find(&records).Error
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		return nil, toGRPCError(err)
+	}
+
+	resp := &myservice.ListRecordsResponse{}
+	if len(records) > size {
+		records = records[:size]
+		resp.NextPageToken = encodePageToken(records[size-1].A)
+	}
+	resp.Records = make([]*myservice.Record, 0, len(records))
+	for _, record := range records {
+		resp.Records = append(resp.Records, &myservice.Record{A: record.A, B: record.B})
+	}
+	return resp, nil
+}
+
+// function GetVersion returns the build information of the running server. It needs neither the database nor a
+// tenant.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//
+// Returns:
+//   - The version, commit and build date
+//   - An error if the operation failed, never in practice
+func (s *MyService) GetVersion(ctx context.Context, req *myservice.GetVersionRequest) (*myservice.GetVersionResponse, error) {
+	return &myservice.GetVersionResponse{Version: version, Commit: commit, BuildDate: buildDate}, nil
+}
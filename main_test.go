@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// testBufferSize is the buffer size of the in-memory connections of the test servers.
+const testBufferSize = 1024 * 1024
+
+// TestMain runs the tests with the log files of every test server in a temporary directory, removed once they ran.
+func TestMain(m *testing.M) {
+	logDir, err := os.MkdirTemp("", "myservice-test-logs")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("LOG_DIR", logDir)
+	code := m.Run()
+	os.RemoveAll(logDir)
+	os.Exit(code)
+}
+
+// newTestConfig loads the configuration of a test server from the environment, without database unless env says
+// otherwise. The variables of env are set for the duration of the test.
+//
+// Parameters:
+//   - t: The test
+//   - env: The environment variables of the test, e.g. RATE_LIMIT_RPS
+//
+// Returns:
+//   - The configuration
+func newTestConfig(t testing.TB, env map[string]string) *Config {
+	t.Helper()
+	defaults := map[string]string{
+		"DB_ENABLED":      "false",
+		"DB_AUTO_MIGRATE": "false",
+		"LOG_TO_STDOUT":   "false",
+		"DB_RETRY_MAX":    "0",
+		// Never listened on, the test servers serve an in-memory listener
+		"GRPC_LISTEN_PORT": "1",
+	}
+	for name, value := range defaults {
+		if _, ok := env[name]; !ok {
+			t.Setenv(name, value)
+		}
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// sqliteTestEnv are the variables of a test server on its own migrated in-memory SQLite database, for the tests
+// checking what the database stores.
+var sqliteTestEnv = map[string]string{
+	"DB_ENABLED":      "true",
+	"DB_DRIVER":       "sqlite",
+	"DB_AUTO_MIGRATE": "true",
+}
+
+// newMockDatabase opens a GORM database on top of sqlmock, checking at the end of the test that every expected
+// statement ran.
+//
+// Parameters:
+//   - t: The test
+//
+// Returns:
+//   - The GORM database
+//   - The mock the expected statements are declared on
+func newMockDatabase(t testing.TB) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	db, err := gorm.Open(gormmysql.New(gormmysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatalf("gorm.Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		sqlDB.Close()
+	})
+	return db, mock
+}
+
+// startTestServer builds the application of cfg, serves it on an in-memory listener and dials it. The client
+// connection is closed and the application stopped at the end of the test.
+//
+// Parameters:
+//   - t: The test
+//   - cfg: The configuration
+//   - opts: The options of the application, e.g. WithDatabase
+//
+// Returns:
+//   - The started application
+//   - The client connection to its gRPC server
+func startTestServer(t testing.TB, cfg *Config, opts ...Option) (*Application, *grpc.ClientConn) {
+	t.Helper()
+	lis := bufconn.Listen(testBufferSize)
+	app, err := New(cfg, append([]Option{WithListener(lis)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := app.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(app.stop)
+	return app, dialTestServer(t, lis)
+}
+
+// dialTestServer dials a test server on its in-memory listener, the connection being closed at the end of the test.
+//
+// Parameters:
+//   - t: The test
+//   - lis: The listener of the server
+//   - opts: The additional dial options, e.g. grpc.WithStatsHandler
+//
+// Returns:
+//   - The client connection
+func dialTestServer(t testing.TB, lis *bufconn.Listener, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///bufnet", append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestMyMethodStopsOnContextEnd checks that a query still running when the client cancels the call or its deadline
+// expires is stopped, the call failing with the matching code instead of waiting for the database.
+func TestMyMethodStopsOnContextEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		// end ends the context of the call while the query runs
+		end  func(ctx context.Context) (context.Context, context.CancelFunc)
+		want codes.Code
+	}{
+		{
+			name: "canceled",
+			end: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(ctx)
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: codes.Canceled,
+		},
+		{
+			name: "deadline exceeded",
+			end: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(ctx, 50*time.Millisecond)
+			},
+			want: codes.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMockDatabase(t)
+			_, conn := startTestServer(t, newTestConfig(t, nil), WithDatabase(db))
+			mock.ExpectBegin()
+			// The lookup of the soft deleted record outlasts the call
+			mock.ExpectQuery("SELECT `a` FROM `table_records`").WillDelayFor(5 * time.Second).
+				WillReturnRows(sqlmock.NewRows([]string{"a"}))
+			mock.ExpectRollback()
+
+			ctx, cancel := tt.end(context.Background())
+			defer cancel()
+			start := time.Now()
+			_, err := myservice.NewMyServiceClient(conn).MyMethod(ctx, &myservice.MyRequest{A: "key", B: 1})
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("MyMethod returned %v, want %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("MyMethod returned after %s, the query wasn't stopped", elapsed)
+			}
+		})
+	}
+}
+
+// TestCreateRecordStopsOnContextEnd checks the error CreateRecord returns itself, without the client side mapping
+// of a canceled call: the status of the context error.
+func TestCreateRecordStopsOnContextEnd(t *testing.T) {
+	db, mock := newMockDatabase(t)
+	app, _ := startTestServer(t, newTestConfig(t, nil), WithDatabase(db))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT `a` FROM `table_records`").WillDelayFor(5 * time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	mock.ExpectRollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := newRecordService(app).CreateRecord(ctx, "key", 1, nil)
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Fatalf("CreateRecord returned %v, want DeadlineExceeded", err)
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("the context should have expired, got %v", ctx.Err())
+	}
+}
+
+// TestMessageSizeLimits checks that the server rejects with ResourceExhausted a request above GRPC_MAX_RECV_MSG_SIZE
+// and a response above GRPC_MAX_SEND_MSG_SIZE, over the wire.
+func TestMessageSizeLimits(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, map[string]string{
+		"GRPC_MAX_RECV_MSG_SIZE": "1024",
+		"GRPC_MAX_SEND_MSG_SIZE": "8",
+	}))
+	client := myservice.NewMyServiceClient(conn)
+	ctx := context.Background()
+	request := func(size int) *myservice.MyRequest {
+		return &myservice.MyRequest{A: "key", D: map[string]string{"payload": strings.Repeat("x", size)}}
+	}
+
+	// Below the limit the request reaches the handler, which needs the disabled database
+	if _, err := client.MyMethod(ctx, request(512)); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("MyMethod below the receive limit returned %v, want FailedPrecondition", err)
+	}
+	if _, err := client.MyMethod(ctx, request(2048)); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("MyMethod above the receive limit returned %v, want ResourceExhausted", err)
+	}
+	if _, err := client.GetVersion(ctx, &myservice.GetVersionRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("GetVersion above the send limit returned %v, want ResourceExhausted", err)
+	}
+}
+
+// TestCreateRecords checks that CreateRecords reports the outcome of every record, creating the valid ones, and
+// that a transactional call failing on a record creates none.
+func TestCreateRecords(t *testing.T) {
+	app, conn := startTestServer(t, newTestConfig(t, sqliteTestEnv))
+	client := myservice.NewMyServiceClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.CreateRecords(ctx, &myservice.CreateRecordsRequest{Records: []*myservice.MyRequest{
+		{A: "key1", B: 1},
+		{A: "", B: 2},
+		{A: "key1", B: 3},
+		{A: "key2", B: 4},
+	}})
+	if err != nil {
+		t.Fatalf("CreateRecords: %v", err)
+	}
+	if resp.GetCreated() != 2 {
+		t.Fatalf("Created = %d, want 2", resp.GetCreated())
+	}
+	want := []codes.Code{codes.OK, codes.InvalidArgument, codes.InvalidArgument, codes.OK}
+	for i, result := range resp.GetResults() {
+		if codes.Code(result.GetCode()) != want[i] {
+			t.Fatalf("record %d: code %v (%s), want %v", i, codes.Code(result.GetCode()), result.GetMessage(), want[i])
+		}
+	}
+
+	_, err = client.CreateRecords(ctx, &myservice.CreateRecordsRequest{Transactional: true, Records: []*myservice.MyRequest{
+		{A: "key3", B: 5},
+		{A: "", B: 6},
+	}})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Fatalf("transactional CreateRecords returned %v, want InvalidArgument", err)
+	}
+	var count int64
+	if err := app.primaryDB().Model(&TableRecord{}).Where("a = ?", "key3").Count(&count).Error; err != nil {
+		t.Fatalf("counting the records: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("the failed transactional call stored %d records, want none", count)
+	}
+}
+
+// TestStreamRecords checks that StreamRecords sends the stored records ordered by key, up to the requested limit.
+func TestStreamRecords(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, sqliteTestEnv))
+	client := myservice.NewMyServiceClient(conn)
+	ctx := context.Background()
+	for _, key := range []string{"key3", "key1", "key2"} {
+		if _, err := client.MyMethod(ctx, &myservice.MyRequest{A: key, B: 1}); err != nil {
+			t.Fatalf("MyMethod %s: %v", key, err)
+		}
+	}
+
+	receive := func(limit int32) []string {
+		t.Helper()
+		stream, err := client.StreamRecords(ctx, &myservice.StreamRecordsRequest{Limit: limit})
+		if err != nil {
+			t.Fatalf("StreamRecords: %v", err)
+		}
+		var keys []string
+		for {
+			record, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return keys
+			}
+			if err != nil {
+				t.Fatalf("receiving record %d: %v", len(keys), err)
+			}
+			keys = append(keys, record.GetA())
+		}
+	}
+	if got := strings.Join(receive(0), ","); got != "key1,key2,key3" {
+		t.Fatalf("StreamRecords sent %s, want key1,key2,key3", got)
+	}
+	if got := strings.Join(receive(2), ","); got != "key1,key2" {
+		t.Fatalf("StreamRecords with limit 2 sent %s, want key1,key2", got)
+	}
+}
+
+// TestDeleteRecordNotFound inserts a record, deletes it and checks that reading or deleting it again returns NotFound
+// with its key, the cached copy included, and that the key can be used again.
+func TestDeleteRecordNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		hard bool
+	}{
+		{"soft delete", false},
+		{"hard delete", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := maps.Clone(sqliteTestEnv)
+			env["CACHE_SIZE"] = "10"
+			_, conn := startTestServer(t, newTestConfig(t, env))
+			client := myservice.NewMyServiceClient(conn)
+			ctx := context.Background()
+
+			if _, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key", B: 1}); err != nil {
+				t.Fatalf("MyMethod: %v", err)
+			}
+			// Cache the record before deleting it
+			if _, err := client.GetRecord(ctx, &myservice.GetRecordRequest{A: "key"}); err != nil {
+				t.Fatalf("GetRecord before the delete: %v", err)
+			}
+			if _, err := client.DeleteRecord(ctx, &myservice.DeleteRecordRequest{A: "key", Hard: tt.hard}); err != nil {
+				t.Fatalf("DeleteRecord: %v", err)
+			}
+
+			_, err := client.GetRecord(ctx, &myservice.GetRecordRequest{A: "key"})
+			if status.Code(err) != codes.NotFound {
+				t.Fatalf("GetRecord after the delete returned %v, want NotFound", err)
+			}
+			if msg := status.Convert(err).Message(); !strings.Contains(msg, `"key"`) {
+				t.Fatalf("NotFound message %q doesn't name the key", msg)
+			}
+			_, err = client.DeleteRecord(ctx, &myservice.DeleteRecordRequest{A: "key", Hard: tt.hard})
+			if status.Code(err) != codes.NotFound {
+				t.Fatalf("second DeleteRecord returned %v, want NotFound", err)
+			}
+
+			if _, err := client.MyMethod(ctx, &myservice.MyRequest{A: "key", B: 2}); err != nil {
+				t.Fatalf("MyMethod with the deleted key: %v", err)
+			}
+			record, err := client.GetRecord(ctx, &myservice.GetRecordRequest{A: "key"})
+			if err != nil {
+				t.Fatalf("GetRecord of the new record: %v", err)
+			}
+			if record.GetB() != 2 {
+				t.Fatalf("GetRecord returned b %d, want the 2 of the new record", record.GetB())
+			}
+		})
+	}
+}
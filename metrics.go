@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// messageSizeBuckets are the buckets of the message size histograms, from 64 bytes to 16 MiB, around the 4 MiB
+// default of GRPC_MAX_RECV_MSG_SIZE.
+var messageSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+// Prometheus collectors for the gRPC server, labeled by full method name and status code.
+var (
+	// rpcRequestsTotal counts the handled RPCs
+	rpcRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_method", "grpc_code"})
+	// rpcErrorsTotal counts the RPCs that returned a non-OK status code
+	rpcErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_errors_total",
+		Help: "Total number of RPCs completed on the server with a non-OK status code.",
+	}, []string{"grpc_method", "grpc_code"})
+	// rpcDurationSeconds observes the RPC handling latency
+	rpcDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Histogram of RPC handling latency in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_method", "grpc_code"})
+	// rpcInFlight is the number of unary RPCs and streams currently handled
+	rpcInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "grpc_server_in_flight_requests",
+		Help: "Number of RPCs and streams currently handled by the server.",
+	})
+	// rpcRequestSizeBytes observes the serialized size of the received messages, labeled by full method name only
+	rpcRequestSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_request_size_bytes",
+		Help:    "Histogram of the serialized size in bytes of the messages received by the server.",
+		Buckets: messageSizeBuckets,
+	}, []string{"grpc_method"})
+	// rpcResponseSizeBytes observes the serialized size of the sent messages, labeled by full method name only
+	rpcResponseSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_response_size_bytes",
+		Help:    "Histogram of the serialized size in bytes of the messages sent by the server.",
+		Buckets: messageSizeBuckets,
+	}, []string{"grpc_method"})
+)
+
+func init() {
+	prometheus.MustRegister(rpcRequestsTotal, rpcErrorsTotal, rpcDurationSeconds, rpcInFlight,
+		rpcRequestSizeBytes, rpcResponseSizeBytes)
+}
+
+// metricsUnaryInterceptor records the request count, error count and latency of every unary RPC, the size of its
+// request and response, and counts it in flight while it is handled.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	// Deferred so a panic recovered by the outer interceptor doesn't leave the RPC counted
+	rpcInFlight.Inc()
+	defer rpcInFlight.Dec()
+	// Recorded before the handler so the rejected requests count too, e.g. an oversized one failing the validation
+	observeMessageSize(rpcRequestSizeBytes, info.FullMethod, req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		observeMessageSize(rpcResponseSizeBytes, info.FullMethod, resp)
+	}
+	code := status.Code(err).String()
+	rpcRequestsTotal.WithLabelValues(info.FullMethod, code).Inc()
+	if err != nil {
+		rpcErrorsTotal.WithLabelValues(info.FullMethod, code).Inc()
+	}
+	rpcDurationSeconds.WithLabelValues(info.FullMethod, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// inFlightStreamInterceptor counts every stream in flight while it is handled, the streaming counterpart of the
+// in-flight gauge of metricsUnaryInterceptor.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - The error of the handler
+func inFlightStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rpcInFlight.Inc()
+	defer rpcInFlight.Dec()
+	return handler(srv, ss)
+}
+
+// messageSizeStreamInterceptor records the size of every message received and sent on a stream, the streaming
+// counterpart of the size histograms of metricsUnaryInterceptor.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - The error of the handler
+func messageSizeStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &messageSizeServerStream{ServerStream: ss, method: info.FullMethod})
+}
+
+// messageSizeServerStream is a server stream recording the size of its messages.
+type messageSizeServerStream struct {
+	grpc.ServerStream
+	// method is the full method name of the stream
+	method string
+}
+
+// RecvMsg receives a message and records its size.
+func (s *messageSizeServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	observeMessageSize(rpcRequestSizeBytes, s.method, m)
+	return nil
+}
+
+// SendMsg sends a message and records its size.
+func (s *messageSizeServerStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	observeMessageSize(rpcResponseSizeBytes, s.method, m)
+	return nil
+}
+
+// observeMessageSize records the serialized size of a message, the size MaxRecvMsgSize and MaxSendMsgSize limit,
+// before any compression.
+//
+// Parameters:
+//   - histogram: The size histogram
+//   - method: The full method name
+//   - msg: The message, ignored if it isn't a protobuf message
+func observeMessageSize(histogram *prometheus.HistogramVec, method string, msg any) {
+	if m, ok := msg.(proto.Message); ok {
+		histogram.WithLabelValues(method).Observe(float64(proto.Size(m)))
+	}
+}
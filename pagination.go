@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+
+	"google.golang.org/grpc/codes"
+)
+
+// encodePageToken builds the opaque page token continuing after the given record key.
+//
+// Parameters:
+//   - lastA: The a key of the last record of the page
+//
+// Returns:
+//   - The page token
+func encodePageToken(lastA string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastA))
+}
+
+// decodePageToken returns the record key a page token continues after.
+//
+// Parameters:
+//   - token: The page token, empty for the first page
+//
+// Returns:
+//   - The a key of the last record of the previous page, "" for the first page
+//   - A codes.InvalidArgument status error if the token is malformed
+func decodePageToken(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	lastA, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(lastA) == 0 {
+		return "", errorWithInfo(codes.InvalidArgument, reasonInvalidArgument, "invalid page_token", map[string]string{"field": "page_token"})
+	}
+	return string(lastA), nil
+}
+
+// pageSize resolves the page size of a list request, using the default for 0 and capping it to the maximum.
+//
+// Parameters:
+//   - requested: The page size of the request
+//   - defaultSize: The page size used when the request leaves it to 0
+//   - maxSize: The maximum page size
+//
+// Returns:
+//   - The page size to query
+//   - A codes.InvalidArgument status error if the requested size is negative
+func pageSize(requested int32, defaultSize int, maxSize int) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, errorWithInfo(codes.InvalidArgument, reasonInvalidArgument, "page_size must not be negative", map[string]string{"field": "page_size"})
+	case requested == 0:
+		return defaultSize, nil
+	case int(requested) > maxSize:
+		return maxSize, nil
+	default:
+		return int(requested), nil
+	}
+}
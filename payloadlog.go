@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// redactedValue replaces the value of the redacted fields in the logged payloads.
+const redactedValue = "[REDACTED]"
+
+// payloadLogger logs the request and response messages of the RPCs as JSON for debugging (LOG_PAYLOADS).
+// The messages can hold personal data, so it is meant for a development or an incident debugging session only.
+type payloadLogger struct {
+	// redactFields are the lower-cased proto names of the fields whose value is replaced by redactedValue
+	redactFields map[string]bool
+	// maxBytes is the size past which a logged payload is truncated
+	maxBytes int
+}
+
+// newPayloadLogger creates a payload logger.
+//
+// Parameters:
+//   - redactFields: The proto names of the fields to redact, at any depth, matched ignoring case
+//     (LOG_PAYLOAD_REDACT_FIELDS)
+//   - maxBytes: The size past which a logged payload is truncated (LOG_PAYLOAD_MAX_BYTES)
+//
+// Returns:
+//   - The payload logger
+func newPayloadLogger(redactFields []string, maxBytes int) *payloadLogger {
+	p := &payloadLogger{redactFields: make(map[string]bool, len(redactFields)), maxBytes: maxBytes}
+	for _, field := range redactFields {
+		p.redactFields[strings.ToLower(field)] = true
+	}
+	return p
+}
+
+// unaryInterceptor logs the request of every unary RPC before the handler runs, then its response when it succeeds.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed
+func (p *payloadLogger) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	p.log(ctx, "rpc request payload", info.FullMethod, req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		p.log(ctx, "rpc response payload", info.FullMethod, resp)
+	}
+	return resp, err
+}
+
+// streamInterceptor logs every message received and sent on a stream.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - The error of the handler
+func (p *payloadLogger) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &payloadServerStream{ServerStream: ss, logger: p, method: info.FullMethod})
+}
+
+// payloadServerStream is a server stream logging its messages.
+type payloadServerStream struct {
+	grpc.ServerStream
+	// logger logs the messages
+	logger *payloadLogger
+	// method is the full method name of the stream
+	method string
+}
+
+// RecvMsg receives a message and logs it.
+func (s *payloadServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.logger.log(s.Context(), "stream received payload", s.method, m)
+	return nil
+}
+
+// SendMsg sends a message and logs it.
+func (s *payloadServerStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.logger.log(s.Context(), "stream sent payload", s.method, m)
+	return nil
+}
+
+// log logs a message as redacted and truncated JSON.
+//
+// Parameters:
+//   - ctx: The context of the request, carrying the request ID of the log line
+//   - msg: The log message
+//   - method: The full method name
+//   - m: The message, ignored if it isn't a protobuf message
+func (p *payloadLogger) log(ctx context.Context, msg string, method string, m any) {
+	message, ok := m.(proto.Message)
+	if !ok {
+		return
+	}
+	payload, err := p.format(message)
+	if err != nil {
+		loggerFromContext(ctx).Warn("failed to format payload", "method", method, "error", err)
+		return
+	}
+	loggerFromContext(ctx).Info(msg, "method", method, "payload", payload)
+}
+
+// format marshals a message to JSON with its proto field names, replaces the values of the redacted fields and
+// truncates the result to maxBytes.
+//
+// Parameters:
+//   - m: The message
+//
+// Returns:
+//   - The JSON payload
+//   - An error if the message can't be marshaled
+func (p *payloadLogger) format(m proto.Message) (string, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	if len(p.redactFields) > 0 {
+		// Decode the numbers as json.Number so the re-encoding keeps them as written
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return "", err
+		}
+		if data, err = json.Marshal(p.redact(value)); err != nil {
+			return "", err
+		}
+	}
+	if len(data) > p.maxBytes {
+		return fmt.Sprintf("%s...(%d bytes truncated)", data[:p.maxBytes], len(data)-p.maxBytes), nil
+	}
+	return string(data), nil
+}
+
+// redact replaces the values of the redacted fields of a decoded JSON value, in the nested objects and arrays too.
+//
+// Parameters:
+//   - value: The decoded JSON value, modified in place
+//
+// Returns:
+//   - The redacted value
+func (p *payloadLogger) redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if p.redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = p.redact(field)
+			}
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = p.redact(element)
+		}
+	}
+	return value
+}
@@ -23,7 +23,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MyService_MyMethod_FullMethodName = "/myservice.MyService/MyMethod"
+	MyService_MyMethod_FullMethodName      = "/myservice.MyService/MyMethod"
+	MyService_CreateRecords_FullMethodName = "/myservice.MyService/CreateRecords"
+	MyService_StreamRecords_FullMethodName = "/myservice.MyService/StreamRecords"
+	MyService_GetRecord_FullMethodName     = "/myservice.MyService/GetRecord"
+	MyService_DeleteRecord_FullMethodName  = "/myservice.MyService/DeleteRecord"
+	MyService_ListRecords_FullMethodName   = "/myservice.MyService/ListRecords"
+	MyService_GetVersion_FullMethodName    = "/myservice.MyService/GetVersion"
 )
 
 // MyServiceClient is the client API for MyService service.
@@ -34,6 +40,19 @@ const (
 type MyServiceClient interface {
 	// sample method
 	MyMethod(ctx context.Context, in *MyRequest, opts ...grpc.CallOption) (*MyResponse, error)
+	// sample batch method, creates the records in batches and reports the result of every record
+	CreateRecords(ctx context.Context, in *CreateRecordsRequest, opts ...grpc.CallOption) (*CreateRecordsResponse, error)
+	// sample server streaming method, streams the stored records ordered by a
+	StreamRecords(ctx context.Context, in *StreamRecordsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error)
+	// sample read method, returns the record with the given a or NOT_FOUND
+	GetRecord(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*Record, error)
+	// sample delete method, soft deletes the record with the given a, or hard deletes it with its attributes,
+	// or returns NOT_FOUND
+	DeleteRecord(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error)
+	// sample paginated list method, returns the records ordered by a one page at a time
+	ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error)
+	// returns the version, commit and build date of the running server
+	GetVersion(ctx context.Context, in *GetVersionRequest, opts ...grpc.CallOption) (*GetVersionResponse, error)
 }
 
 type myServiceClient struct {
@@ -54,6 +73,75 @@ func (c *myServiceClient) MyMethod(ctx context.Context, in *MyRequest, opts ...g
 	return out, nil
 }
 
+func (c *myServiceClient) CreateRecords(ctx context.Context, in *CreateRecordsRequest, opts ...grpc.CallOption) (*CreateRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateRecordsResponse)
+	err := c.cc.Invoke(ctx, MyService_CreateRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myServiceClient) StreamRecords(ctx context.Context, in *StreamRecordsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Record], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MyService_ServiceDesc.Streams[0], MyService_StreamRecords_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRecordsRequest, Record]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyService_StreamRecordsClient = grpc.ServerStreamingClient[Record]
+
+func (c *myServiceClient) GetRecord(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*Record, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Record)
+	err := c.cc.Invoke(ctx, MyService_GetRecord_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myServiceClient) DeleteRecord(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteRecordResponse)
+	err := c.cc.Invoke(ctx, MyService_DeleteRecord_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myServiceClient) ListRecords(ctx context.Context, in *ListRecordsRequest, opts ...grpc.CallOption) (*ListRecordsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecordsResponse)
+	err := c.cc.Invoke(ctx, MyService_ListRecords_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myServiceClient) GetVersion(ctx context.Context, in *GetVersionRequest, opts ...grpc.CallOption) (*GetVersionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetVersionResponse)
+	err := c.cc.Invoke(ctx, MyService_GetVersion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MyServiceServer is the server API for MyService service.
 // All implementations must embed UnimplementedMyServiceServer
 // for forward compatibility.
@@ -62,6 +150,19 @@ func (c *myServiceClient) MyMethod(ctx context.Context, in *MyRequest, opts ...g
 type MyServiceServer interface {
 	// sample method
 	MyMethod(context.Context, *MyRequest) (*MyResponse, error)
+	// sample batch method, creates the records in batches and reports the result of every record
+	CreateRecords(context.Context, *CreateRecordsRequest) (*CreateRecordsResponse, error)
+	// sample server streaming method, streams the stored records ordered by a
+	StreamRecords(*StreamRecordsRequest, grpc.ServerStreamingServer[Record]) error
+	// sample read method, returns the record with the given a or NOT_FOUND
+	GetRecord(context.Context, *GetRecordRequest) (*Record, error)
+	// sample delete method, soft deletes the record with the given a, or hard deletes it with its attributes,
+	// or returns NOT_FOUND
+	DeleteRecord(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error)
+	// sample paginated list method, returns the records ordered by a one page at a time
+	ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error)
+	// returns the version, commit and build date of the running server
+	GetVersion(context.Context, *GetVersionRequest) (*GetVersionResponse, error)
 	mustEmbedUnimplementedMyServiceServer()
 }
 
@@ -75,6 +176,24 @@ type UnimplementedMyServiceServer struct{}
 func (UnimplementedMyServiceServer) MyMethod(context.Context, *MyRequest) (*MyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method MyMethod not implemented")
 }
+func (UnimplementedMyServiceServer) CreateRecords(context.Context, *CreateRecordsRequest) (*CreateRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRecords not implemented")
+}
+func (UnimplementedMyServiceServer) StreamRecords(*StreamRecordsRequest, grpc.ServerStreamingServer[Record]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamRecords not implemented")
+}
+func (UnimplementedMyServiceServer) GetRecord(context.Context, *GetRecordRequest) (*Record, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecord not implemented")
+}
+func (UnimplementedMyServiceServer) DeleteRecord(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRecord not implemented")
+}
+func (UnimplementedMyServiceServer) ListRecords(context.Context, *ListRecordsRequest) (*ListRecordsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecords not implemented")
+}
+func (UnimplementedMyServiceServer) GetVersion(context.Context, *GetVersionRequest) (*GetVersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVersion not implemented")
+}
 func (UnimplementedMyServiceServer) mustEmbedUnimplementedMyServiceServer() {}
 func (UnimplementedMyServiceServer) testEmbeddedByValue()                   {}
 
@@ -114,6 +233,107 @@ func _MyService_MyMethod_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MyService_CreateRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyServiceServer).CreateRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyService_CreateRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyServiceServer).CreateRecords(ctx, req.(*CreateRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyService_StreamRecords_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRecordsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MyServiceServer).StreamRecords(m, &grpc.GenericServerStream[StreamRecordsRequest, Record]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyService_StreamRecordsServer = grpc.ServerStreamingServer[Record]
+
+func _MyService_GetRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyServiceServer).GetRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyService_GetRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyServiceServer).GetRecord(ctx, req.(*GetRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyService_DeleteRecord_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyServiceServer).DeleteRecord(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyService_DeleteRecord_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyServiceServer).DeleteRecord(ctx, req.(*DeleteRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyService_ListRecords_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecordsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyServiceServer).ListRecords(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyService_ListRecords_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyServiceServer).ListRecords(ctx, req.(*ListRecordsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyService_GetVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyServiceServer).GetVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyService_GetVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyServiceServer).GetVersion(ctx, req.(*GetVersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MyService_ServiceDesc is the grpc.ServiceDesc for MyService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -125,7 +345,33 @@ var MyService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "MyMethod",
 			Handler:    _MyService_MyMethod_Handler,
 		},
+		{
+			MethodName: "CreateRecords",
+			Handler:    _MyService_CreateRecords_Handler,
+		},
+		{
+			MethodName: "GetRecord",
+			Handler:    _MyService_GetRecord_Handler,
+		},
+		{
+			MethodName: "DeleteRecord",
+			Handler:    _MyService_DeleteRecord_Handler,
+		},
+		{
+			MethodName: "ListRecords",
+			Handler:    _MyService_ListRecords_Handler,
+		},
+		{
+			MethodName: "GetVersion",
+			Handler:    _MyService_GetVersion_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRecords",
+			Handler:       _MyService_StreamRecords_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "myservice.proto",
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// setupPushgateway adds the OnFlush hook pushing the metrics of the default registry to a Prometheus pushgateway,
+// for the batch jobs and the short-lived servers that aren't scraped before they exit. The metrics are grouped by
+// the hostname as the instance label, so the instances of a job don't replace the metrics of each other.
+//
+// Parameters:
+//   - url: The pushgateway URL (PUSHGATEWAY_URL), empty disables the push
+//   - job: The job label of the pushed metrics (PUSHGATEWAY_JOB)
+func (app *Application) setupPushgateway(url string, job string) {
+	if url == "" {
+		return
+	}
+	pusher := push.New(url, job).Gatherer(prometheus.DefaultGatherer)
+	if hostname, err := os.Hostname(); err == nil {
+		pusher = pusher.Grouping("instance", hostname)
+	}
+	app.OnFlush = append(app.OnFlush, func(ctx context.Context) error {
+		if err := pusher.PushContext(ctx); err != nil {
+			return err
+		}
+		log.Printf("Metrics pushed to %s", url)
+		return nil
+	})
+	log.Printf("Metrics push enabled: pushgateway=%s job=%s", url, job)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// maxQueryCommentValueLength bounds the length of a value written into the query comments, the request ID coming
+// from the client.
+const maxQueryCommentValueLength = 128
+
+// registerQueryComments registers the callbacks prepending a /* request_id=... trace_id=... */ comment to every
+// statement run with the context of an RPC, so the slow query log of the database points back to the RPC and its
+// trace. The statements run outside of an RPC are left untouched.
+//
+// Parameters:
+//   - db: The database connection
+//
+// Returns:
+//   - An error if a callback can't be registered
+func registerQueryComments(db *gorm.DB) error {
+	callbacks := db.Callback()
+	// Only the main callback runs through the commentConnPool: the transaction callbacks need the real one, and the
+	// associations and the preloads run statements of their own
+	for _, processor := range []struct {
+		// main is the callback building and running the statements
+		main string
+		// comment and uncomment register the callbacks right before and right after main
+		comment, uncomment func(string, func(*gorm.DB)) error
+	}{
+		{
+			"gorm:create",
+			callbacks.Create().After("gorm:save_before_associations").Before("gorm:create").Register,
+			callbacks.Create().After("gorm:create").Before("gorm:save_after_associations").Register,
+		},
+		{
+			"gorm:query",
+			callbacks.Query().Before("gorm:query").Register,
+			callbacks.Query().After("gorm:query").Before("gorm:preload").Register,
+		},
+		{
+			"gorm:update",
+			callbacks.Update().After("gorm:save_before_associations").Before("gorm:update").Register,
+			callbacks.Update().After("gorm:update").Before("gorm:save_after_associations").Register,
+		},
+		{
+			"gorm:delete",
+			callbacks.Delete().After("gorm:delete_before_associations").Before("gorm:delete").Register,
+			callbacks.Delete().After("gorm:delete").Before("gorm:after_delete").Register,
+		},
+		{"gorm:row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"gorm:raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	} {
+		if err := processor.comment("request_id:comment", commentStatement); err != nil {
+			return fmt.Errorf("failed to register the query comments before %s: %w", processor.main, err)
+		}
+		if err := processor.uncomment("request_id:uncomment", uncommentStatement); err != nil {
+			return fmt.Errorf("failed to register the query comments after %s: %w", processor.main, err)
+		}
+	}
+	return nil
+}
+
+// commentConnPool is the connection pool of a statement prepending its comment to the SQL sent to the database.
+// The dialects build the SQL their own way, the comment is added once it is final.
+type commentConnPool struct {
+	gorm.ConnPool
+	// comment is the comment of the statement
+	comment string
+}
+
+// PrepareContext prepares the commented statement.
+func (p *commentConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.ConnPool.PrepareContext(ctx, p.comment+" "+query)
+}
+
+// ExecContext runs the commented statement.
+func (p *commentConnPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return p.ConnPool.ExecContext(ctx, p.comment+" "+query, args...)
+}
+
+// QueryContext runs the commented query.
+func (p *commentConnPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return p.ConnPool.QueryContext(ctx, p.comment+" "+query, args...)
+}
+
+// QueryRowContext runs the commented single row query.
+func (p *commentConnPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.ConnPool.QueryRowContext(ctx, p.comment+" "+query, args...)
+}
+
+// commentStatement makes a statement run through a commentConnPool adding the comment of its context, if any.
+//
+// Parameters:
+//   - db: The statement being executed
+func commentStatement(db *gorm.DB) {
+	if comment := queryComment(db.Statement); comment != "" {
+		db.Statement.ConnPool = &commentConnPool{ConnPool: db.Statement.ConnPool, comment: comment}
+	}
+}
+
+// uncommentStatement restores the connection pool replaced by commentStatement once the statement ran.
+//
+// Parameters:
+//   - db: The statement executed
+func uncommentStatement(db *gorm.DB) {
+	if pool, ok := db.Statement.ConnPool.(*commentConnPool); ok {
+		db.Statement.ConnPool = pool.ConnPool
+	}
+}
+
+// queryComment builds the comment of a statement from the request ID and the trace ID of its context.
+//
+// Parameters:
+//   - stmt: The statement
+//
+// Returns:
+//   - The comment, "" when the context carries neither
+func queryComment(stmt *gorm.Statement) string {
+	if stmt.Context == nil {
+		return ""
+	}
+	var fields []string
+	if requestID := queryCommentValue(requestIDFromContext(stmt.Context)); requestID != "" {
+		fields = append(fields, "request_id="+requestID)
+	}
+	if span := trace.SpanContextFromContext(stmt.Context); span.HasTraceID() {
+		fields = append(fields, "trace_id="+span.TraceID().String())
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "/* " + strings.Join(fields, " ") + " */"
+}
+
+// queryCommentValue keeps the letters, digits, dashes, underscores, dots and colons of a value, truncated to
+// maxQueryCommentValueLength, so a request ID sent by the client can't close the comment.
+//
+// Parameters:
+//   - value: The raw value
+//
+// Returns:
+//   - The value safe to write into a comment
+func queryCommentValue(value string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+			return r
+		default:
+			return -1
+		}
+	}, value)
+	if len(safe) > maxQueryCommentValueLength {
+		safe = safe[:maxQueryCommentValueLength]
+	}
+	return safe
+}
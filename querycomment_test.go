@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc/metadata"
+)
+
+// TestQueryCommentsPrepareStmt checks that DB_QUERY_COMMENTS turns the prepared statement cache off unless
+// DB_PREPARE_STMT is set, and that enabling both explicitly is rejected.
+func TestQueryCommentsPrepareStmt(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		prepareStmt bool
+		wantErr     bool
+	}{
+		{"default", nil, true, false},
+		{"query comments", map[string]string{"DB_QUERY_COMMENTS": "true"}, false, false},
+		{"query comments without cache", map[string]string{"DB_QUERY_COMMENTS": "true", "DB_PREPARE_STMT": "false"}, false, false},
+		{"query comments with cache", map[string]string{"DB_QUERY_COMMENTS": "true", "DB_PREPARE_STMT": "true"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GRPC_LISTEN_PORT", "1")
+			t.Setenv("DB_ENABLED", "false")
+			t.Setenv("DB_QUERY_COMMENTS", "")
+			t.Setenv("DB_PREPARE_STMT", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig returned %v, want an error: %t", err, tt.wantErr)
+			}
+			if err == nil && cfg.DBPrepareStmt != tt.prepareStmt {
+				t.Fatalf("DBPrepareStmt = %t, want %t", cfg.DBPrepareStmt, tt.prepareStmt)
+			}
+		})
+	}
+}
+
+// TestQueryCommentsInjectedDatabase checks that the queries of a database injected with WithDatabase are commented
+// with the sanitized request ID of their RPC.
+func TestQueryCommentsInjectedDatabase(t *testing.T) {
+	db, mock := newMockDatabase(t)
+	_, conn := startTestServer(t, newTestConfig(t, map[string]string{"DB_QUERY_COMMENTS": "true"}), WithDatabase(db))
+	mock.ExpectQuery(`^/\* request_id=req-42DROP \*/ SELECT \* FROM ` + "`table_records`").
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow("key", 1))
+
+	// The request ID can't close the comment
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDHeader, "req-42 */ DROP")
+	if _, err := myservice.NewMyServiceClient(conn).GetRecord(ctx, &myservice.GetRecordRequest{A: "key"}); err != nil {
+		t.Fatalf("GetRecord: %v", err)
+	}
+}
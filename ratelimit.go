@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimiterIdleTTL is how long the limiter of a client that stopped calling is kept before being evicted.
+const rateLimiterIdleTTL = 3 * time.Minute
+
+// ipRateLimiter is a token bucket rate limiter per client IP address.
+// Its limits can be changed while it is in use, a zero rate disabling it.
+type ipRateLimiter struct {
+	// mu protects the fields below
+	mu sync.Mutex
+	// limit is the sustained number of requests per second allowed for each client
+	limit rate.Limit
+	// burst is the number of requests a client can make at once
+	burst int
+	// clients holds the limiter of every client seen recently, keyed by IP address
+	clients map[string]*clientLimiter
+	// lastSweep is the last time the idle clients were evicted
+	lastSweep time.Time
+}
+
+// clientLimiter is the token bucket of a single client.
+type clientLimiter struct {
+	// limiter is the token bucket
+	limiter *rate.Limiter
+	// lastSeen is the time of the last request of the client
+	lastSeen time.Time
+}
+
+// newIPRateLimiter creates a rate limiter allowing each client rps requests per second with the given burst.
+//
+// Parameters:
+//   - rps: The sustained number of requests per second per client
+//   - burst: The number of requests a client can make at once
+//
+// Returns:
+//   - The rate limiter
+func newIPRateLimiter(rps float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:     rate.Limit(rps),
+		burst:     burst,
+		clients:   make(map[string]*clientLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+// setLimits changes the rate and burst of every client, including the ones already seen.
+//
+// Parameters:
+//   - rps: The sustained number of requests per second per client, 0 disables rate limiting
+//   - burst: The number of requests a client can make at once
+func (l *ipRateLimiter) setLimits(rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = rate.Limit(rps)
+	l.burst = burst
+	now := time.Now()
+	for _, client := range l.clients {
+		client.limiter.SetLimitAt(now, l.limit)
+		client.limiter.SetBurstAt(now, l.burst)
+	}
+}
+
+// allow reports whether the client identified by key can make a request now, consuming a token if so.
+//
+// Parameters:
+//   - key: The client key, usually its IP address
+//
+// Returns:
+//   - true if the request is within the limits or rate limiting is disabled
+func (l *ipRateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Rate limiting is disabled
+	if l.limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	// Evict the clients that stopped calling so the map doesn't grow forever
+	if now.Sub(l.lastSweep) > rateLimiterIdleTTL {
+		for k, client := range l.clients {
+			if now.Sub(client.lastSeen) > rateLimiterIdleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+	return client.limiter.AllowN(now, 1)
+}
+
+// rateLimitUnaryInterceptor builds an interceptor rejecting the RPCs of clients exceeding their rate limit
+// with codes.ResourceExhausted. Clients are identified by the IP address of the peer, see peerIP.
+//
+// Parameters:
+//   - limiter: The per client rate limiter
+//
+// Returns:
+//   - The rate limiting interceptor
+func rateLimitUnaryInterceptor(limiter *ipRateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !limiter.allow(peerIP(ctx)) {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitStreamInterceptor builds an interceptor rejecting the streams opened by clients exceeding their rate limit
+// with codes.ResourceExhausted, a stream counting as one request of the client whatever number of messages it carries.
+//
+// Parameters:
+//   - limiter: The per client rate limiter
+//
+// Returns:
+//   - The rate limiting interceptor
+func rateLimitStreamInterceptor(limiter *ipRateLimiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !limiter.allow(peerIP(ss.Context())) {
+			return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// peerIP returns the IP address of the client calling the RPC, the address of the HTTP client forwarded by the
+// gateway for the REST calls. Addresses without a port, such as unix sockets, are returned as is.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The client IP address, or "" if the peer is unknown
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	// Only the gateway connections can set the client address, another client sending it is identified by its own
+	if _, ok := p.Addr.(gatewayAddr); ok {
+		if ips := metadata.ValueFromIncomingContext(ctx, gatewayClientIPKey); len(ips) > 0 {
+			return ips[0]
+		}
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerContext returns a context of a call made from addr.
+//
+// Parameters:
+//   - addr: The peer address
+//
+// Returns:
+//   - The context carrying the peer
+func peerContext(addr net.Addr) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+}
+
+// TestRateLimitBurst checks that a client sending one call more than its burst gets ResourceExhausted for the extra
+// call, while another client keeps its own bucket.
+func TestRateLimitBurst(t *testing.T) {
+	const burst = 5
+	// Too slow to refill a token during the test
+	interceptor := rateLimitUnaryInterceptor(newIPRateLimiter(0.001, burst))
+	info := &grpc.UnaryServerInfo{FullMethod: "/myservice.MyService/GetRecord"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	first := peerContext(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000})
+	second := peerContext(&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 40000})
+
+	for i := 0; i < burst; i++ {
+		if _, err := interceptor(first, nil, info, handler); err != nil {
+			t.Fatalf("call %d within the burst: %v", i, err)
+		}
+	}
+	if _, err := interceptor(first, nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the burst returned %v, want ResourceExhausted", err)
+	}
+	// The port doesn't matter, the client is identified by its IP address
+	again := peerContext(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40001})
+	if _, err := interceptor(again, nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the burst from another port returned %v, want ResourceExhausted", err)
+	}
+	for i := 0; i < burst; i++ {
+		if _, err := interceptor(second, nil, info, handler); err != nil {
+			t.Fatalf("call %d of the second client: %v", i, err)
+		}
+	}
+}
+
+// TestPeerIP checks the client addresses the rate limiter keys its buckets by, the gateway connections only being
+// identified by the address of their HTTP client.
+func TestPeerIP(t *testing.T) {
+	forwarded := metadata.Pairs(gatewayClientIPKey, "203.0.113.7")
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"tcp peer", peerContext(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}), "10.0.0.1"},
+		{"unix peer", peerContext(&net.UnixAddr{Name: "/run/myservice.sock", Net: "unix"}), "/run/myservice.sock"},
+		{"no peer", context.Background(), ""},
+		{"gateway", metadata.NewIncomingContext(peerContext(gatewayAddr{}), forwarded), "203.0.113.7"},
+		{"gateway without client address", peerContext(gatewayAddr{}), "gateway"},
+		{
+			"client setting the gateway metadata",
+			metadata.NewIncomingContext(peerContext(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}), forwarded),
+			"10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerIP(tt.ctx); got != tt.want {
+				t.Fatalf("peerIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRateLimitStreams checks that opening a stream consumes a token of the client, a client over its burst getting
+// ResourceExhausted instead of a new stream.
+func TestRateLimitStreams(t *testing.T) {
+	_, conn := startTestServer(t, newTestConfig(t, map[string]string{
+		"RATE_LIMIT_RPS":   "0.001",
+		"RATE_LIMIT_BURST": "1",
+	}))
+	client := myservice.NewMyServiceClient(conn)
+	ctx := context.Background()
+
+	// Within the burst the stream reaches the handler, which needs the disabled database
+	stream, err := client.StreamRecords(ctx, &myservice.StreamRecordsRequest{})
+	if err != nil {
+		t.Fatalf("StreamRecords: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("stream within the burst returned %v, want FailedPrecondition", err)
+	}
+	stream, err = client.StreamRecords(ctx, &myservice.StreamRecordsRequest{})
+	if err != nil {
+		t.Fatalf("StreamRecords: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("stream over the burst returned %v, want ResourceExhausted", err)
+	}
+}
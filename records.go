@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
+)
+
+// RecordService holds the business logic of the record RPCs on plain Go values, the MyService handlers only
+// converting the protobuf messages. It runs without any gRPC machinery, so it can be called directly, e.g. by a test
+// of an Application built by New with a sqlmock database injected with WithDatabase.
+type RecordService struct {
+	// app gives access to the configuration, the databases and the record cache
+	app *Application
+}
+
+// newRecordService creates the record service of an application.
+//
+// Parameters:
+//   - app: The application
+//
+// Returns:
+//   - The record service
+func newRecordService(app *Application) *RecordService {
+	return &RecordService{app: app}
+}
+
+// CreateRecord validates and creates a record and its attributes in the database, in a single transaction so either
+// all of them are stored or none. A soft deleted record of the same key is replaced, see purgeDeletedRecords. The
+// record is stamped with the subject of the principal of ctx when the call is authenticated.
+//
+// Parameters:
+//   - ctx: The context of the request, bounding the queries and carrying the principal and the tenant
+//   - a: The record key
+//   - b: The record value
+//   - attributes: The attributes of the record, by name
+//
+// Returns:
+//   - The created record
+//   - A status error if the key is invalid, the database is unavailable, or the creation failed, mapped with
+//     toGRPCError and carrying the key in its metadata
+func (s *RecordService) CreateRecord(ctx context.Context, a string, b int32, attributes map[string]string) (*TableRecord, error) {
+	// Reject invalid input before hitting the database
+	if err := validateRecordKey(a, s.app.config.RecordKeyMaxLength); err != nil {
+		return nil, err
+	}
+	if err := s.app.databaseAvailable(); err != nil {
+		return nil, err
+	}
+
+	// Stamp the record with its creator when the call is authenticated
+	principal, _ := principalFromContext(ctx)
+
+	// Perform some operation, bound to the RPC context so cancellations and deadlines stop the queries
+	record := TableRecord{A: a, B: b, CreatedBy: principal.Subject}
+	rows := make([]RecordAttribute, 0, len(attributes))
+	for name, value := range attributes {
+		rows = append(rows, RecordAttribute{RecordA: a, Name: name, Value: value})
+	}
+	dbCtx, span := tracer.Start(ctx, "db.create_record")
+	err := s.app.withRetry(dbCtx, func() error {
+		return s.app.inTransaction(dbCtx, func(tx *gorm.DB) error {
+			if err := purgeDeletedRecords(tx, []string{a}); err != nil {
+				return err
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+			// Any failure here rolls back the record created above
+			if len(rows) > 0 {
+				return tx.Create(&rows).Error
+			}
+			return nil
+		})
+	})
+	s.app.invalidateRecords(recordCacheKey(ctx, a))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		return nil, withErrorMetadata(toGRPCError(err), "a", a)
+	}
+	return &record, nil
+}
+
+// purgeDeletedRecords removes the soft deleted records of keys with their attributes, so the keys can be created
+// again: a soft deleted record keeps its row, and its primary key, for audit while the read methods report it as
+// missing. Run it in the transaction creating the records, right before the inserts.
+//
+// Parameters:
+//   - tx: The transaction creating the records
+//   - keys: The keys of the records about to be created
+//
+// Returns:
+//   - An error if the soft deleted records can't be looked up or removed
+func purgeDeletedRecords(tx *gorm.DB, keys []string) error {
+	var deleted []string
+	if err := tx.Unscoped().Model(&TableRecord{}).Where("a IN ? AND deleted_at IS NOT NULL", keys).Pluck("a", &deleted).Error; err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	if err := tx.Where("record_a IN ?", deleted).Delete(&RecordAttribute{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("a IN ?", deleted).Delete(&TableRecord{}).Error
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCreateRecordTimestamps checks that CreateRecord returns the record with the CreatedAt and UpdatedAt set by
+// GORM, as stored in the database, and that an update only refreshes UpdatedAt.
+func TestCreateRecordTimestamps(t *testing.T) {
+	app, _ := startTestServer(t, newTestConfig(t, sqliteTestEnv))
+	ctx := context.Background()
+
+	before := time.Now()
+	record, err := newRecordService(app).CreateRecord(ctx, "key", 1, nil)
+	if err != nil {
+		t.Fatalf("CreateRecord: %v", err)
+	}
+	if record.CreatedAt.Before(before) || record.CreatedAt.After(time.Now()) {
+		t.Fatalf("CreatedAt = %s, want the insert time", record.CreatedAt)
+	}
+	if !record.UpdatedAt.Equal(record.CreatedAt) {
+		t.Fatalf("UpdatedAt = %s, want CreatedAt %s", record.UpdatedAt, record.CreatedAt)
+	}
+
+	var stored TableRecord
+	if err := app.primaryDB().First(&stored, "a = ?", "key").Error; err != nil {
+		t.Fatalf("reading the record back: %v", err)
+	}
+	if !stored.CreatedAt.Equal(record.CreatedAt) || !stored.UpdatedAt.Equal(record.UpdatedAt) {
+		t.Fatalf("stored timestamps %s and %s, want the returned %s and %s",
+			stored.CreatedAt, stored.UpdatedAt, record.CreatedAt, record.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := app.primaryDB().Model(&stored).Update("B", 2).Error; err != nil {
+		t.Fatalf("updating the record: %v", err)
+	}
+	var updated TableRecord
+	if err := app.primaryDB().First(&updated, "a = ?", "key").Error; err != nil {
+		t.Fatalf("reading the record back: %v", err)
+	}
+	if !updated.CreatedAt.Equal(record.CreatedAt) {
+		t.Fatalf("CreatedAt changed by the update to %s, want %s", updated.CreatedAt, record.CreatedAt)
+	}
+	if !updated.UpdatedAt.After(record.UpdatedAt) {
+		t.Fatalf("UpdatedAt = %s after the update, want later than %s", updated.UpdatedAt, record.UpdatedAt)
+	}
+}
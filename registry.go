@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// consulRequestTimeout bounds every call to the Consul agent API
+	consulRequestTimeout = 5 * time.Second
+	// consulCheckInterval is how often Consul runs the health check of the registered instance
+	consulCheckInterval = "10s"
+	// consulCheckTimeout bounds every health check run by Consul
+	consulCheckTimeout = "5s"
+	// consulDeregisterAfter is how long an instance can be critical before Consul removes it, e.g. after a crash
+	// that skipped the deregistration
+	consulDeregisterAfter = "1m"
+)
+
+// ServiceRegistrar registers the running instance with a service discovery system, e.g. Consul or etcd.
+// Register is called by start once the server serves, and Deregister at the beginning of stop, before the drain,
+// so the clients stop discovering the instance while its in-flight requests complete.
+type ServiceRegistrar interface {
+	// Register announces the instance
+	Register(ctx context.Context) error
+	// Deregister removes the instance announced by Register
+	Deregister(ctx context.Context) error
+}
+
+// serviceInstance is the address and health check of the instance announced to the service discovery.
+type serviceInstance struct {
+	// id identifies the instance among the ones of the same service
+	id string
+	// name is the service name the clients discover (SERVICE_NAME)
+	name string
+	// host is the host the clients connect to (SERVICE_ADDRESS)
+	host string
+	// port is the gRPC port the clients connect to
+	port int
+	// tls reports whether the gRPC server requires TLS
+	tls bool
+	// healthHTTPPort is the port of the /readyz probe, 0 checks the health with the gRPC health service instead
+	healthHTTPPort int
+}
+
+// newServiceInstance resolves the instance announced to the service discovery from the configuration.
+//
+// Parameters:
+//   - cfg: The application configuration
+//
+// Returns:
+//   - The instance
+//   - An error if the advertised host or the gRPC port can't be resolved
+func newServiceInstance(cfg *Config) (serviceInstance, error) {
+	host := cfg.ServiceAddress
+	if host == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return serviceInstance{}, fmt.Errorf("failed to resolve the service address, set SERVICE_ADDRESS: %w", err)
+		}
+		host = hostname
+	}
+	network, addr := cfg.listenAddress()
+	if network != "tcp" {
+		return serviceInstance{}, fmt.Errorf("can't register a service listening on %s %s", network, addr)
+	}
+	_, portValue, err := net.SplitHostPort(addr)
+	if err != nil {
+		return serviceInstance{}, fmt.Errorf("invalid listen address %s: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		return serviceInstance{}, fmt.Errorf("invalid listen port %s: %w", portValue, err)
+	}
+	return serviceInstance{
+		id:             fmt.Sprintf("%s-%s-%d", cfg.ServiceName, host, port),
+		name:           cfg.ServiceName,
+		host:           host,
+		port:           port,
+		tls:            cfg.TLSCertFile != "",
+		healthHTTPPort: cfg.HealthHTTPPort,
+	}, nil
+}
+
+// consulRegistrar is a ServiceRegistrar registering the instance with the local Consul agent over its HTTP API.
+type consulRegistrar struct {
+	// addr is the base URL of the Consul agent, e.g. http://localhost:8500
+	addr string
+	// instance is the registered instance
+	instance serviceInstance
+	// client sends the requests to the agent
+	client *http.Client
+}
+
+// newConsulRegistrar creates a registrar of the instance with the Consul agent at addr.
+//
+// Parameters:
+//   - addr: The Consul agent address, "host:port" or a http(s) URL (CONSUL_ADDR)
+//   - instance: The instance to register
+//
+// Returns:
+//   - The Consul registrar
+func newConsulRegistrar(addr string, instance serviceInstance) *consulRegistrar {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &consulRegistrar{
+		addr:     strings.TrimSuffix(addr, "/"),
+		instance: instance,
+		client:   &http.Client{Timeout: consulRequestTimeout},
+	}
+}
+
+// consulService is the service definition of the Consul agent register endpoint.
+type consulService struct {
+	ID      string      `json:"ID"`
+	Name    string      `json:"Name"`
+	Address string      `json:"Address"`
+	Port    int         `json:"Port"`
+	Check   consulCheck `json:"Check"`
+}
+
+// consulCheck is the health check of a consulService, either HTTP or GRPC is set.
+type consulCheck struct {
+	HTTP                           string `json:"HTTP,omitempty"`
+	GRPC                           string `json:"GRPC,omitempty"`
+	GRPCUseTLS                     bool   `json:"GRPCUseTLS,omitempty"`
+	TLSSkipVerify                  bool   `json:"TLSSkipVerify,omitempty"`
+	Interval                       string `json:"Interval"`
+	Timeout                        string `json:"Timeout"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// Register registers the instance with the Consul agent, with a health check on the /readyz probe when
+// HEALTH_HTTP_PORT is set and on the gRPC health service of MyService otherwise.
+//
+// Parameters:
+//   - ctx: The context of the registration
+//
+// Returns:
+//   - An error if the agent can't be reached or rejected the registration
+func (r *consulRegistrar) Register(ctx context.Context) error {
+	instance := r.instance
+	check := consulCheck{
+		Interval:                       consulCheckInterval,
+		Timeout:                        consulCheckTimeout,
+		DeregisterCriticalServiceAfter: consulDeregisterAfter,
+	}
+	if instance.healthHTTPPort != 0 {
+		check.HTTP = fmt.Sprintf("http://%s/readyz", net.JoinHostPort(instance.host, strconv.Itoa(instance.healthHTTPPort)))
+	} else {
+		check.GRPC = net.JoinHostPort(instance.host, strconv.Itoa(instance.port)) + "/" + myServiceName
+		// Consul checks the health, it doesn't need to verify who it talks to
+		check.GRPCUseTLS = instance.tls
+		check.TLSSkipVerify = instance.tls
+	}
+	body, err := json.Marshal(consulService{
+		ID:      instance.id,
+		Name:    instance.name,
+		Address: instance.host,
+		Port:    instance.port,
+		Check:   check,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.put(ctx, "/v1/agent/service/register", body); err != nil {
+		return fmt.Errorf("failed to register %s with Consul: %w", instance.id, err)
+	}
+	log.Printf("Registered %s as %s:%d with Consul at %s", instance.id, instance.host, instance.port, r.addr)
+	return nil
+}
+
+// Deregister removes the instance from the Consul agent.
+//
+// Parameters:
+//   - ctx: The context of the deregistration
+//
+// Returns:
+//   - An error if the agent can't be reached or rejected the deregistration
+func (r *consulRegistrar) Deregister(ctx context.Context) error {
+	if err := r.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(r.instance.id), nil); err != nil {
+		return fmt.Errorf("failed to deregister %s from Consul: %w", r.instance.id, err)
+	}
+	log.Printf("Deregistered %s from Consul", r.instance.id)
+	return nil
+}
+
+// put sends a PUT request to the Consul agent API.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - path: The API path
+//   - body: The JSON request body, nil for none
+//
+// Returns:
+//   - An error if the request failed or the agent answered with a non 2xx status
+func (r *consulRegistrar) put(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, r.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// registerService registers the instance with the ServiceRegistrar, if any.
+//
+// Parameters:
+//   - ctx: The context of the registration
+//
+// Returns:
+//   - The error of the registrar
+func (app *Application) registerService(ctx context.Context) error {
+	if app.registrar == nil {
+		return nil
+	}
+	return app.registrar.Register(ctx)
+}
+
+// deregisterService removes the instance from the ServiceRegistrar, if any. A failure is logged only,
+// the instance is removed anyway by the discovery once its health check fails.
+//
+// Parameters:
+//   - ctx: The context of the deregistration, done after SHUTDOWN_HOOKS_TIMEOUT
+func (app *Application) deregisterService(ctx context.Context) {
+	if app.registrar == nil {
+		return
+	}
+	if err := app.registrar.Deregister(ctx); err != nil {
+		log.Printf("Service deregistration failed: %v", err)
+	}
+}
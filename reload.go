@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"reflect"
+)
+
+// reloadableSettings are the Config fields applied by reload while the server runs, keyed by field name.
+var reloadableSettings = map[string]bool{
+	"LogLevel":       true,
+	"RateLimitRPS":   true,
+	"RateLimitBurst": true,
+	"FeatureFlags":   true,
+}
+
+// reload method reads the environment files again and applies the hot-reloadable settings, the log level, the
+// rate limits and the feature flags, without dropping connections. The file values replace the ones loaded before, including the
+// variables set in the process environment. The other settings that changed are logged as ignored until
+// the next restart, and an invalid configuration is logged and ignored entirely.
+func (app *Application) reload() {
+	log.Printf("Reloading configuration from %v", app.configPaths)
+	cfg, err := loadConfig(app.configPaths, true)
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping the current settings: %v", err)
+		return
+	}
+
+	// Report the changed settings that need a restart
+	current := reflect.ValueOf(app.config).Elem()
+	reloaded := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Name
+		if reloadableSettings[name] {
+			continue
+		}
+		if !reflect.DeepEqual(current.Field(i).Interface(), reloaded.Field(i).Interface()) {
+			log.Printf("Configuration setting %s changed, ignored until restart", name)
+		}
+	}
+
+	if cfg.LogLevel != app.config.LogLevel {
+		app.setLogLevel(cfg.LogLevel)
+		app.config.LogLevel = cfg.LogLevel
+		log.Printf("Log level set to %s", cfg.LogLevel)
+	}
+	if cfg.RateLimitRPS != app.config.RateLimitRPS || cfg.RateLimitBurst != app.config.RateLimitBurst {
+		app.rateLimiter.setLimits(cfg.RateLimitRPS, cfg.RateLimitBurst)
+		app.config.RateLimitRPS = cfg.RateLimitRPS
+		app.config.RateLimitBurst = cfg.RateLimitBurst
+		log.Printf("Rate limits set to rps=%g burst=%d", cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+	if !maps.Equal(cfg.FeatureFlags, app.config.FeatureFlags) {
+		app.setFeatureFlags(cfg.FeatureFlags)
+		app.config.FeatureFlags = cfg.FeatureFlags
+		log.Printf("Feature flags set to %v", cfg.FeatureFlags)
+	}
+	log.Println("Configuration reloaded")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDHeader is the metadata key carrying the request ID, in the request and in the response trailer.
+const requestIDHeader = "x-request-id"
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// requestIDUnaryInterceptor reads the request ID from the x-request-id metadata, generating a UUID when absent,
+// stores it in the context for the following interceptors and the handler, and echoes it in the response trailer.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed
+func requestIDUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, requestID := contextWithRequestID(ctx)
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(requestIDHeader, requestID)); err != nil {
+		loggerFromContext(ctx).Warn("failed to set the request ID trailer", "error", err)
+	}
+	return handler(ctx, req)
+}
+
+// requestIDStreamInterceptor is the streaming counterpart of requestIDUnaryInterceptor,
+// the handler seeing the request ID in the context of the stream.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - An error if the handler failed
+func requestIDStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, requestID := contextWithRequestID(ss.Context())
+	ss.SetTrailer(metadata.Pairs(requestIDHeader, requestID))
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextWithRequestID reads the request ID from the x-request-id metadata, generating a UUID when absent,
+// and stores it in the context.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The context carrying the request ID
+//   - The request ID
+func contextWithRequestID(ctx context.Context) (context.Context, string) {
+	requestID := ""
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDHeader); len(values) > 0 {
+		requestID = values[0]
+	}
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID), requestID
+}
+
+// requestIDFromContext returns the ID of the request being served.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The request ID, or "" outside of an RPC
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// loggerFromContext returns the structured logger to use while serving a request,
+// adding the request ID and the tenant to every line when the context carries them.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The logger
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	if t, ok := tenantFromContext(ctx); ok {
+		logger = logger.With("tenant", t.id)
+	}
+	return logger
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortSupported reports whether several listeners can share a port with SO_REUSEPORT on this platform.
+const reusePortSupported = true
+
+// reusePortControl sets SO_REUSEPORT on a listening socket before it is bound, so several sockets can listen
+// on the same port, the kernel spreading the incoming connections between them.
+//
+// Parameters:
+//   - network: The network of the socket
+//   - address: The address the socket is bound to
+//   - c: The raw socket
+//
+// Returns:
+//   - An error if the option couldn't be set
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
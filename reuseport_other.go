@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// reusePortSupported reports whether several listeners can share a port with SO_REUSEPORT on this platform.
+const reusePortSupported = false
+
+// reusePortControl does nothing where SO_REUSEPORT isn't supported, a single listener is opened instead.
+//
+// Parameters:
+//   - network: The network of the socket
+//   - address: The address the socket is bound to
+//   - c: The raw socket
+//
+// Returns:
+//   - Always nil
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// gracePeriodMargin is kept between the end of the longest shutdown and the end of the grace period, for the process
+// to exit before SIGKILL.
+const gracePeriodMargin = time.Second
+
+// kubernetesDefaultGracePeriod is the terminationGracePeriodSeconds of a pod that doesn't set it.
+const kubernetesDefaultGracePeriod = 30 * time.Second
+
+// shutdownDuration returns the longest time stop can take, the pre-drain delay plus the timeouts of every phase.
+// The flush phase is counted even though it only runs with OnFlush hooks, which are added after the setup.
+//
+// Returns:
+//   - The longest shutdown duration
+func (cfg *Config) shutdownDuration() time.Duration {
+	return cfg.ShutdownHooksTimeout + cfg.ShutdownPredrain + cfg.ShutdownFlushTimeout + cfg.ShutdownTimeout +
+		cfg.ShutdownStreamGrace + cfg.ShutdownCleanupTimeout
+}
+
+// fitShutdownToGracePeriod clamps SHUTDOWN_TIMEOUT when the longest shutdown doesn't fit in K8S_GRACE_PERIOD, so
+// the platform doesn't kill the server mid-drain with SIGKILL, logging a warning. The grace period of a pod isn't
+// visible from inside it: without K8S_GRACE_PERIOD, a server running in Kubernetes only warns when the shutdown
+// exceeds the default 30s.
+//
+// Parameters:
+//   - cfg: The configuration, whose ShutdownTimeout is clamped
+func fitShutdownToGracePeriod(cfg *Config) {
+	total := cfg.shutdownDuration()
+	if cfg.GracePeriod <= 0 {
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" && total > kubernetesDefaultGracePeriod {
+			log.Printf("WARNING: the shutdown can take up to %s, longer than the default Kubernetes grace period of %s; "+
+				"set K8S_GRACE_PERIOD to the terminationGracePeriodSeconds of the pod to clamp SHUTDOWN_TIMEOUT", total, kubernetesDefaultGracePeriod)
+		}
+		return
+	}
+	// validate ensures the other phases leave some time to the drain
+	budget := cfg.GracePeriod - gracePeriodMargin
+	if total <= budget {
+		return
+	}
+	drain := cfg.ShutdownTimeout - (total - budget)
+	log.Printf("WARNING: the shutdown can take up to %s, longer than K8S_GRACE_PERIOD %s less a %s margin, "+
+		"the platform would kill the server mid-shutdown: SHUTDOWN_TIMEOUT clamped from %s to %s",
+		total, cfg.GracePeriod, gracePeriodMargin, cfg.ShutdownTimeout, drain)
+	cfg.ShutdownTimeout = drain
+}
+
+// shutdownFunc releases a resource during stop, it should give up when ctx is done.
+type shutdownFunc func(ctx context.Context) error
+
+// namedShutdown is a shutdown function registered with the name of the resource it releases.
+type namedShutdown struct {
+	// name identifies the resource in the shutdown logs
+	name string
+	// fn releases the resource
+	fn shutdownFunc
+}
+
+// addShutdown registers a function releasing a resource during stop.
+// The functions run in reverse registration order after the gRPC server stopped,
+// so a resource is released before the resources it was built on. A function registered once stop ran them,
+// by a background goroutine racing the shutdown, is run right away instead of never.
+//
+// Parameters:
+//   - name: The resource name used in the shutdown logs
+//   - fn: The function releasing the resource
+func (app *Application) addShutdown(name string, fn shutdownFunc) {
+	app.shutdownMu.Lock()
+	if !app.stopped {
+		app.shutdownFuncs = append(app.shutdownFuncs, namedShutdown{name: name, fn: fn})
+		app.shutdownMu.Unlock()
+		return
+	}
+	app.shutdownMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.ShutdownCleanupTimeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		log.Printf("Error shutting down %s, opened after the shutdown: %v", name, err)
+		return
+	}
+	log.Printf("%s opened after the shutdown, shut down", name)
+}
+
+// isStopped tells whether stop already ran the shutdown functions, so a resource opened now wouldn't be released.
+//
+// Returns:
+//   - true once the shutdown functions ran
+func (app *Application) isStopped() bool {
+	app.shutdownMu.Lock()
+	defer app.shutdownMu.Unlock()
+	return app.stopped
+}
+
+// addCloser registers an io.Closer closed during stop, see addShutdown.
+// The close is abandoned when the shutdown context is done, see closeContext.
+//
+// Parameters:
+//   - name: The resource name used in the shutdown logs
+//   - closer: The resource to close
+func (app *Application) addCloser(name string, closer io.Closer) {
+	app.addShutdown(name, func(ctx context.Context) error {
+		return closeContext(ctx, closer.Close)
+	})
+}
+
+// closeContext runs a blocking close function that doesn't accept a context, giving up on it when ctx is done.
+// The close keeps running in the background then, but the shutdown moves on to the next resources.
+//
+// Parameters:
+//   - ctx: The shutdown context bounding the wait
+//   - closeFn: The function releasing the resource
+//
+// Returns:
+//   - The error of closeFn, or the context error if it didn't return in time
+func closeContext(ctx context.Context, closeFn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- closeFn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runShutdownFuncs runs the registered shutdown functions in reverse registration order.
+// A failing function is logged and doesn't prevent the following ones from running. Once ctx is done
+// the remaining functions are skipped and logged, as the cleanup phase has been abandoned.
+//
+// Parameters:
+//   - ctx: The shutdown context shared by every function
+func (app *Application) runShutdownFuncs(ctx context.Context) {
+	app.shutdownMu.Lock()
+	shutdownFuncs := app.shutdownFuncs
+	app.stopped = true
+	app.shutdownMu.Unlock()
+	for i := len(shutdownFuncs) - 1; i >= 0; i-- {
+		shutdown := shutdownFuncs[i]
+		if ctx.Err() != nil {
+			log.Printf("Skipping shutdown of %s: %v", shutdown.name, ctx.Err())
+			continue
+		}
+		if err := shutdown.fn(ctx); err != nil {
+			log.Printf("Error shutting down %s: %v", shutdown.name, err)
+			continue
+		}
+		log.Printf("%s shut down", shutdown.name)
+	}
+}
+
+// runShutdownPhase runs one phase of the shutdown with its own timeout.
+// The phase is abandoned when it outlives the timeout, even if fn ignores ctx, and the timeout is logged
+// with the phase name.
+//
+// Parameters:
+//   - name: The phase name used in the shutdown logs
+//   - timeout: The maximum duration of the phase
+//   - fn: The phase, it should give up when ctx is done
+//
+// Returns:
+//   - true if the phase completed within the timeout
+func runShutdownPhase(name string, timeout time.Duration, fn func(ctx context.Context)) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		fn(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		log.Printf("Shutdown phase %s timed out after %s", name, timeout)
+		return false
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+)
+
+// tenantIDHeader is the metadata header selecting the tenant of a request with MULTITENANT.
+const tenantIDHeader = "tenant-id"
+
+// schemaNamePattern matches the schema names accepted in TENANT_SCHEMAS.
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// tenantExemptPrefixes are the full method name prefixes of the services and methods that don't belong to a tenant,
+// called without the tenant-id header by the probes and the tools.
+var tenantExemptPrefixes = []string{"/grpc.health.v1.Health/", "/grpc.reflection.", "/myservice.MyService/GetVersion"}
+
+// tenantKey is the context key of the tenant of a request.
+type tenantKey struct{}
+
+// tenant is the tenant a request was made for.
+type tenant struct {
+	// id is the tenant ID of the tenant-id header
+	id string
+	// schema is the schema holding the tables of the tenant
+	schema string
+}
+
+// tenantUnaryInterceptor builds an interceptor resolving the tenant of every RPC from the tenant-id metadata header
+// and storing it in the context, where the database callbacks registered by registerTenantScope find it.
+// A request without the header is rejected with codes.InvalidArgument, one for a tenant missing from schemas with
+// codes.PermissionDenied.
+//
+// Parameters:
+//   - schemas: The schemas of the tenants keyed by tenant ID (TENANT_SCHEMAS)
+//
+// Returns:
+//   - The tenant interceptor
+func tenantUnaryInterceptor(schemas map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := contextWithTenant(ctx, info.FullMethod, schemas)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// tenantStreamInterceptor is the streaming counterpart of tenantUnaryInterceptor, rejecting the stream before the
+// handler runs.
+//
+// Parameters:
+//   - schemas: The schemas of the tenants keyed by tenant ID (TENANT_SCHEMAS)
+//
+// Returns:
+//   - The tenant interceptor
+func tenantStreamInterceptor(schemas map[string]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := contextWithTenant(ss.Context(), info.FullMethod, schemas)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextWithTenant resolves the tenant of the tenant-id metadata header and stores it in the context.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - fullMethod: The full method name, the tenantExemptPrefixes methods are served without a tenant
+//   - schemas: The schemas of the tenants keyed by tenant ID
+//
+// Returns:
+//   - The context carrying the tenant
+//   - A codes.InvalidArgument error if the header is missing, codes.PermissionDenied if the tenant is unknown
+func contextWithTenant(ctx context.Context, fullMethod string, schemas map[string]string) (context.Context, error) {
+	for _, prefix := range tenantExemptPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return ctx, nil
+		}
+	}
+	values := metadata.ValueFromIncomingContext(ctx, tenantIDHeader)
+	if len(values) == 0 || values[0] == "" {
+		return nil, errorWithInfo(codes.InvalidArgument, reasonTenantRequired, "missing "+tenantIDHeader+" header",
+			map[string]string{"header": tenantIDHeader})
+	}
+	id := values[0]
+	schema, ok := schemas[id]
+	if !ok {
+		return nil, errorWithInfo(codes.PermissionDenied, reasonUnknownTenant, fmt.Sprintf("unknown tenant %q", id),
+			map[string]string{"tenant": id})
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant{id: id, schema: schema}), nil
+}
+
+// tenantFromContext returns the tenant of the request being served.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The tenant
+//   - false without MULTITENANT, outside of an RPC or for a tenantExemptPrefixes method
+func tenantFromContext(ctx context.Context) (tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(tenant)
+	return t, ok
+}
+
+// registerTenantScope registers the callbacks qualifying the table of every create, query, update, delete and
+// row statement with the schema of the tenant of the statement context, so the handlers reach the tables of the
+// tenant through the shared connection pool as long as they pass the request context with WithContext.
+// The raw SQL statements of Raw and Exec are left untouched.
+//
+// Parameters:
+//   - db: The database connection
+//
+// Returns:
+//   - An error if a callback can't be registered
+func registerTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, register := range []func(string, func(*gorm.DB)) error{
+		callbacks.Create().Before("*").Register,
+		callbacks.Query().Before("*").Register,
+		callbacks.Update().Before("*").Register,
+		callbacks.Delete().Before("*").Register,
+		callbacks.Row().Before("*").Register,
+	} {
+		if err := register("tenant:scope_table", scopeTenantTable); err != nil {
+			return fmt.Errorf("failed to register the tenant scope: %w", err)
+		}
+	}
+	return nil
+}
+
+// scopeTenantTable qualifies the table of a statement with the schema of its tenant, if any.
+//
+// Parameters:
+//   - db: The statement being executed
+func scopeTenantTable(db *gorm.DB) {
+	t, ok := tenantFromContext(db.Statement.Context)
+	// An already qualified table was chosen explicitly
+	if !ok || db.Statement.Table == "" || strings.Contains(db.Statement.Table, ".") {
+		return
+	}
+	db.Statement.Table = t.schema + "." + db.Statement.Table
+}
+
+// migrateTenantSchemas migrates the tables of every tenant schema of TENANT_SCHEMAS. The schemas must exist.
+//
+// Parameters:
+//   - db: The primary database connection
+//
+// Returns:
+//   - An error if the migration of a schema failed
+func (app *Application) migrateTenantSchemas(db *gorm.DB) error {
+	for id, schema := range app.config.TenantSchemas {
+		if err := app.migrateTenantSchema(db, schema); err != nil {
+			return fmt.Errorf("failed to migrate schema %s of tenant %s: %w", schema, id, err)
+		}
+		log.Printf("Schema %s of tenant %s migrated", schema, id)
+	}
+	return nil
+}
+
+// migrateTenantSchema migrates the tables of a tenant schema on a dedicated connection selecting the schema,
+// the migrator looking the tables up in the current schema. The connection is discarded afterwards instead of
+// going back to the pool, where it would keep the tenant schema selected.
+//
+// Parameters:
+//   - db: The primary database connection
+//   - schema: The tenant schema
+//
+// Returns:
+//   - An error if the schema can't be selected or migrated
+func (app *Application) migrateTenantSchema(db *gorm.DB, schema string) error {
+	// The schema name is checked against schemaNamePattern, it is safe to write into the statement
+	selectSchema := "USE " + schema
+	if app.config.DBDriver == "postgres" {
+		selectSchema = "SET search_path TO " + schema
+	}
+	return db.Connection(func(tx *gorm.DB) error {
+		if conn, ok := tx.Statement.ConnPool.(*sql.Conn); ok {
+			defer conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		if err := tx.Exec(selectSchema).Error; err != nil {
+			return err
+		}
+		return tx.AutoMigrate(app.schemaModels()...)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// timeoutUnaryInterceptor builds an interceptor bounding every RPC with a server side timeout. The handler context
+// gets the timeout of the method when the client sent no deadline or a later one, so the queries of a handler stop
+// with codes.DeadlineExceeded once it elapsed. A shorter client deadline is kept as is.
+//
+// Parameters:
+//   - defaultTimeout: The timeout of the methods without an override, 0 for no timeout
+//   - overrides: The timeouts keyed by full method name, 0 for no timeout
+//
+// Returns:
+//   - The timeout interceptor
+func timeoutUnaryInterceptor(defaultTimeout time.Duration, overrides map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		timeout, ok := overrides[info.FullMethod]
+		if !ok {
+			timeout = defaultTimeout
+		}
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+			return handler(ctx, req)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// timeoutStreamInterceptor builds an interceptor bounding every stream with a server side timeout, the same way as
+// timeoutUnaryInterceptor: once the timeout of the method elapsed, the stream ends with codes.DeadlineExceeded.
+//
+// Parameters:
+//   - defaultTimeout: The timeout of the methods without an override, 0 for no timeout
+//   - overrides: The timeouts keyed by full method name, 0 for no timeout
+//
+// Returns:
+//   - The timeout interceptor
+func timeoutStreamInterceptor(defaultTimeout time.Duration, overrides map[string]time.Duration) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		timeout, ok := overrides[info.FullMethod]
+		if !ok {
+			timeout = defaultTimeout
+		}
+		if timeout <= 0 {
+			return handler(srv, ss)
+		}
+		if deadline, ok := ss.Context().Deadline(); ok && time.Until(deadline) <= timeout {
+			return handler(srv, ss)
+		}
+		ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+		defer cancel()
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
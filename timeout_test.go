@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// endlessStreamService is a MyService whose StreamRecords never sends anything, holding the stream until its context
+// ends.
+type endlessStreamService struct {
+	myservice.UnimplementedMyServiceServer
+}
+
+// StreamRecords waits for the end of the stream context.
+func (endlessStreamService) StreamRecords(_ *myservice.StreamRecordsRequest, stream grpc.ServerStreamingServer[myservice.Record]) error {
+	<-stream.Context().Done()
+	return toGRPCError(stream.Context().Err())
+}
+
+// TestStreamTimeout checks that SERVER_METHOD_TIMEOUT ends a stream held open by the server with DeadlineExceeded,
+// and that a method override of 0 removes the cap of the stream.
+func TestStreamTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// capped tells whether the server ends the stream before the one second deadline of the client
+		capped bool
+	}{
+		{"capped", map[string]string{"SERVER_METHOD_TIMEOUT": "50ms"}, true},
+		{
+			"override removing the cap",
+			map[string]string{
+				"SERVER_METHOD_TIMEOUT":  "50ms",
+				"SERVER_METHOD_TIMEOUTS": "/myservice.MyService/StreamRecords=0",
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, conn := startTestServer(t, newTestConfig(t, tt.env), WithRegisterServices(func(server *grpc.Server, app *Application) {
+				myservice.RegisterMyServiceServer(server, endlessStreamService{})
+			}))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			start := time.Now()
+			stream, err := myservice.NewMyServiceClient(conn).StreamRecords(ctx, &myservice.StreamRecordsRequest{})
+			if err != nil {
+				t.Fatalf("StreamRecords: %v", err)
+			}
+			if _, err := stream.Recv(); status.Code(err) != codes.DeadlineExceeded {
+				t.Fatalf("stream returned %v, want DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); (elapsed < 500*time.Millisecond) != tt.capped {
+				t.Fatalf("stream ended after %s, capped by the server: %t", elapsed, tt.capped)
+			}
+		})
+	}
+}
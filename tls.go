@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// newServerTLSCredentials builds the gRPC transport credentials of the server certificate.
+// When a client CA file is configured, clients must present a certificate signed by one of its CAs (mutual TLS).
+//
+// Parameters:
+//   - cfg: The application configuration
+//
+// Returns:
+//   - The TLS transport credentials
+//   - An error if the certificate, the key or the client CA file can't be loaded
+func newServerTLSCredentials(cfg *Config) (credentials.TransportCredentials, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS credentials: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.TLSClientCAFile != "" {
+		clientCAs, err := loadCertPool(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client CA file: %w", err)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// loadCertPool loads a PEM CA bundle into a certificate pool.
+//
+// Parameters:
+//   - path: The path of the PEM file
+//
+// Returns:
+//   - The certificate pool
+//   - An error if the file can't be read or holds no PEM certificate
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s contains no PEM certificate", path)
+	}
+	return pool, nil
+}
+
+// clientCommonName returns the common name of the verified client certificate of the RPC, with mutual TLS.
+// Use it to log or authorize the calling service in interceptors and handlers.
+//
+// Parameters:
+//   - ctx: The context of the request
+//
+// Returns:
+//   - The client certificate common name, or "" without a verified client certificate
+func clientCommonName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+}
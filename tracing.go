@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracer creates the spans of the template code, it follows the global tracer provider set by setupTracing.
+var tracer = otel.Tracer("github.com/lploc94/go_grpc_server_template")
+
+// setupTracing initializes the global tracer provider exporting spans to the OTLP collector.
+// The exporter reads the standard OTEL_EXPORTER_OTLP_* environment variables (endpoint, headers, insecure, ...)
+// and the service name from OTEL_SERVICE_NAME. The provider is shut down in stop so pending spans are flushed.
+//
+// Parameters:
+//   - endpoint: The OTLP collector endpoint, an empty endpoint leaves tracing a no-op
+//
+// Returns:
+//   - An error if the exporter can't be created
+func (app *Application) setupTracing(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	exporter, err := otlptracegrpc.New(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	// Flush the spans before the drain, the shutdown exporting the ones of the drained RPCs
+	app.OnFlush = append(app.OnFlush, provider.ForceFlush)
+	app.addShutdown("tracer provider", provider.Shutdown)
+	log.Printf("Tracing enabled, exporting spans to %s", endpoint)
+	return nil
+}
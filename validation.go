@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lploc94/go_grpc_server_template/protoc/myservice"
+	"google.golang.org/grpc/codes"
+)
+
+// recordKeyColumnSize is the size of the a column of TableRecord created by the schema migration, the default and
+// the maximum of RECORD_KEY_MAX_LENGTH while DB_AUTO_MIGRATE is set. Keep it in sync with the size tags of TableRecord.A
+// and RecordAttribute.RecordA.
+const recordKeyColumnSize = 255
+
+// validateMyRequest checks the MyRequest fields before they are written to the database.
+//
+// Parameters:
+//   - req: The request message
+//   - maxKeyLength: The maximum length in bytes of the a field (RECORD_KEY_MAX_LENGTH)
+//
+// Returns:
+//   - A codes.InvalidArgument status error if a field is invalid, nil otherwise
+func validateMyRequest(req *myservice.MyRequest, maxKeyLength int) error {
+	return validateRecordKey(req.GetA(), maxKeyLength)
+}
+
+// validateRecordKey checks the a field of a request, the primary key of TableRecord, so a key longer than the
+// column is rejected with its limit instead of failing the insert with a data too long error.
+//
+// Parameters:
+//   - a: The record key
+//   - maxLength: The maximum length in bytes of the key (RECORD_KEY_MAX_LENGTH)
+//
+// Returns:
+//   - A codes.InvalidArgument status error if the key is empty or too long, nil otherwise
+func validateRecordKey(a string, maxLength int) error {
+	if a == "" {
+		return errorWithInfo(codes.InvalidArgument, reasonInvalidArgument, "a is required", map[string]string{"field": "a"})
+	}
+	if len(a) > maxLength {
+		return errorWithInfo(codes.InvalidArgument, reasonInvalidArgument,
+			fmt.Sprintf("a must be at most %d bytes, got %d", maxLength, len(a)),
+			map[string]string{"field": "a", "max_length": strconv.Itoa(maxLength)})
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Build information, set at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// version is the version of the build
+	version = "dev"
+	// commit is the commit the build was made from
+	commit = "unknown"
+	// buildDate is the date of the build
+	buildDate = "unknown"
+)
+
+// serverVersionHeader is the response trailer carrying the version of the server on every RPC.
+const serverVersionHeader = "x-server-version"
+
+// versionUnaryInterceptor sets the x-server-version response trailer of every unary RPC, so the calls can be
+// correlated with the deployed build.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - req: The request message
+//   - info: The information about the called method
+//   - handler: The handler that serves the request
+//
+// Returns:
+//   - The response message
+//   - An error if the handler failed
+func versionUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(serverVersionHeader, version)); err != nil {
+		loggerFromContext(ctx).Warn("failed to set the server version trailer", "error", err)
+	}
+	return handler(ctx, req)
+}
+
+// versionStreamInterceptor is the streaming counterpart of versionUnaryInterceptor.
+//
+// Parameters:
+//   - srv: The service implementation
+//   - ss: The server stream
+//   - info: The information about the called method
+//   - handler: The handler that serves the stream
+//
+// Returns:
+//   - An error if the handler failed
+func versionStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ss.SetTrailer(metadata.Pairs(serverVersionHeader, version))
+	return handler(srv, ss)
+}